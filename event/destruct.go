@@ -3,40 +3,210 @@ package event
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+)
+
+// RedactedValue is the value used in place of struct fields tagged with `redact`.
+const RedactedValue = "[REDACTED]"
+
+// StructTagJSONFallback controls whether the `json` struct tag is used for fields which do not have a `sawmill` tag.
+// Only the name, `omitempty`, and `-` options of the json tag are honored.
+//
+// This should be set before any events are generated.
+var StructTagJSONFallback = false
+
+// Limits applied when copying event fields. This prevents a large or deeply nested value from consuming excessive memory.
+// A value of 0 means unlimited.
+//
+// These should be set before any events are generated.
+var (
+	// MaxFieldDepth is the maximum nesting depth of structs, maps, and slices. Values nested deeper are replaced with MaxDepthPlaceholder.
+	MaxFieldDepth = 32
+	// MaxSliceLength is the maximum number of elements copied from a slice or array. When a slice is truncated, its flat fields include a TruncatedKey entry with the number of elements omitted.
+	MaxSliceLength = 1000
+	// MaxFlatFields is the maximum number of flat fields in an event. Once reached, no further fields are copied, and the flat fields include a TruncatedKey entry.
+	MaxFlatFields = 10000
+)
+
+// Placeholder values used when copying event fields.
+const (
+	// CyclePlaceholder replaces a value which refers back to one of its parents (e.g. a tree node with a parent pointer).
+	CyclePlaceholder = "<cycle>"
+	// MaxDepthPlaceholder replaces a value nested deeper than MaxFieldDepth.
+	MaxDepthPlaceholder = "<max depth>"
+	// TruncatedKey is the flat field key added when values have been omitted due to MaxSliceLength or MaxFlatFields.
+	TruncatedKey = "_truncated"
 )
 
 // deStruct will take any input object and return a copy of it, a scalar representation, and a `map[string]interface{}` of any nested attributes.
 // The scalar representation is so that if an object has an underlaying value, and then satisfies an interface, such as `Error()`, that we get both values.
 // If the object satisfies the `fmt.Stringer` interface (it has a `String()` method), then we will return that value without diving into nested attributes.
+// If the object satisfies the Valuer or Fielder interface, or has a registered ValueFunc, the converted value is used in place of the object.
+// If the object is an error, the nested attributes describe its type and chain of wrapped errors. See errorFields().
 func deStruct(data interface{}) (interface{}, interface{}, map[string]interface{}) {
+	dataCopy, dataScalar, flat := (&deStructor{}).deStruct(data)
+	return dataCopy, dataScalar, flat.values
+}
+func (ds *deStructor) deStruct(data interface{}) (interface{}, interface{}, flatMap) {
 	dataValue := reflect.ValueOf(data)
-	return deStructValue(dataValue)
+	dataCopy, dataScalar, flat := ds.deStructValue(dataValue)
+	if flat.values == nil {
+		flat = ds.newFlatMap(0)
+	}
+	if ds.truncated {
+		flat.set(TruncatedKey, true)
+	}
+	return dataCopy, dataScalar, flat
+}
+
+// deStructor holds the state of a single deStruct() call.
+type deStructor struct {
+	// visited contains the pointers, maps, and slices currently being walked. Encountering one again means there is a cycle.
+	visited map[visitKey]bool
+	// depth is the current container nesting depth.
+	depth int
+	// flatCount is the number of flat fields generated so far.
+	flatCount int
+	// truncated indicates that MaxFlatFields was reached.
+	truncated bool
+	// errorStack is the stack trace carried by an error within the data, if any.
+	errorStack []uintptr
+	// recycled is an empty flat field map from a pooled event. It is used for the first (outermost) container, which becomes the event's FlatFields.
+	recycled *flatMap
+}
+
+// flatMap is a flat field map, along with the order in which its keys were added.
+// The zero value is an empty map which must not be added to.
+type flatMap struct {
+	values map[string]interface{}
+	keys   []string
+}
+
+func newFlatMap(size int) flatMap {
+	return flatMap{values: make(map[string]interface{}, size), keys: make([]string, 0, size)}
+}
+
+// newFlatMap returns a flat field map for a container, reusing the recycled map if there is one.
+func (ds *deStructor) newFlatMap(size int) flatMap {
+	if ds.recycled != nil {
+		flat := *ds.recycled
+		ds.recycled = nil
+		return flat
+	}
+	return newFlatMap(size)
+}
+
+// set sets a key, recording the order in which keys are added.
+func (flat *flatMap) set(key string, value interface{}) {
+	if _, ok := flat.values[key]; !ok {
+		flat.keys = append(flat.keys, key)
+	}
+	flat.values[key] = value
+}
+
+type visitKey struct {
+	ptr      uintptr
+	dataType reflect.Type
+	len      int
+}
+
+// enter marks the value as being walked. If the value is already being walked, false is returned, indicating a cycle.
+func (ds *deStructor) enter(dataValue reflect.Value) (visitKey, bool) {
+	key := visitKey{ptr: dataValue.Pointer(), dataType: dataValue.Type()}
+	if dataValue.Kind() == reflect.Slice {
+		key.len = dataValue.Len()
+	}
+	if ds.visited == nil {
+		ds.visited = map[visitKey]bool{}
+	}
+	if ds.visited[key] {
+		return key, false
+	}
+	ds.visited[key] = true
+	return key, true
+}
+func (ds *deStructor) leave(key visitKey) {
+	delete(ds.visited, key)
+}
+
+// enterContainer increments the nesting depth. If the depth exceeds MaxFieldDepth, false is returned.
+func (ds *deStructor) enterContainer() bool {
+	if MaxFieldDepth > 0 && ds.depth >= MaxFieldDepth {
+		return false
+	}
+	ds.depth++
+	return true
+}
+func (ds *deStructor) leaveContainer() {
+	ds.depth--
+}
+
+// full indicates whether MaxFlatFields has been reached.
+func (ds *deStructor) full() bool {
+	if MaxFlatFields > 0 && ds.flatCount >= MaxFlatFields {
+		ds.truncated = true
+		return true
+	}
+	return false
 }
-func deStructValue(dataValue reflect.Value) (interface{}, interface{}, map[string]interface{}) {
+
+// addFlat adds the results of deStructing a nested value to a flat field map under the given key.
+func (ds *deStructor) addFlat(flatData *flatMap, key string, fieldScalar interface{}, fieldMap flatMap) {
+	if fieldScalar != nil {
+		flatData.set(key, fieldScalar)
+		ds.flatCount++
+	}
+	for _, fieldMapKey := range fieldMap.keys {
+		flatData.set(key+"."+fieldMapKey, fieldMap.values[fieldMapKey])
+	}
+}
+
+func (ds *deStructor) deStructValue(dataValue reflect.Value) (interface{}, interface{}, flatMap) {
+	if dataValue.IsValid() && dataValue.Type() == deferredType && !dataValue.IsNil() {
+		// Deferred values must not be evaluated until a handler needs them, so pass them through as is.
+		deferred := dataValue.Interface()
+		return deferred, deferred, flatMap{}
+	}
+	if dataValue.IsValid() && dataValue.Type() == fieldSliceType && dataValue.CanInterface() {
+		// an ordered set of fields, which is logged as a map that keeps the order
+		flatData := ds.newFlatMap(dataValue.Len())
+		return ds.deStructFields(dataValue.Interface().([]Field), &flatData), nil, flatData
+	}
+	if value, ok := getValue(dataValue); ok {
+		// The replacement value is not checked again, so that a Valuer may return a value of its own type.
+		return ds.deStructRaw(reflect.ValueOf(value))
+	}
+	return ds.deStructRaw(dataValue)
+}
+
+// deStructRaw performs deStructValue without checking for a Valuer, Fielder, or registered ValueFunc.
+func (ds *deStructor) deStructRaw(dataValue reflect.Value) (interface{}, interface{}, flatMap) {
 	var dataCopy interface{}
 	var dataScalar interface{}
-	var flatFields map[string]interface{}
+	var flatFields flatMap
 
-	var deStructX func(reflect.Value) (interface{}, interface{}, map[string]interface{})
+	var deStructX func(reflect.Value) (interface{}, interface{}, flatMap)
 	kind := dataValue.Kind()
 	switch kind {
 	case reflect.Ptr:
-		deStructX = deStructPointer
+		deStructX = ds.deStructPointer
 	case reflect.Interface:
-		deStructX = deStructInterface
+		deStructX = ds.deStructInterface
 	case reflect.Struct:
-		deStructX = deStructStruct
+		deStructX = ds.deStructStruct
 	case reflect.Map:
-		deStructX = deStructMap
+		deStructX = ds.deStructMap
 	case reflect.Array, reflect.Slice:
-		deStructX = deStructSlice
+		deStructX = ds.deStructSlice
 	case reflect.Chan:
-		deStructX = deStructChan
+		deStructX = ds.deStructChan
 	case reflect.Func:
-		deStructX = deStructFunction
+		deStructX = ds.deStructFunction
 	default:
-		deStructX = deStructScalar
+		deStructX = ds.deStructScalar
 	}
 	dataCopy, dataScalar, flatFields = deStructX(dataValue)
 
@@ -45,19 +215,27 @@ func deStructValue(dataValue reflect.Value) (interface{}, interface{}, map[strin
 			// has a string interface. Discard dataScalar and flatFields
 			// Basically we called deStructX() only for the dataCopy
 			dataScalar = stringer.String()
-			flatFields = map[string]interface{}{}
+			flatFields = flatMap{}
 		}
 
 		if errorer, ok := dataValue.Interface().(error); ok {
 			dataScalar = errorer.Error()
-			flatFields = map[string]interface{}{}
+			flatFields = ds.errorFields(errorer)
 		}
 	}
 
 	return dataCopy, dataScalar, flatFields
 }
-func deStructPointer(dataValue reflect.Value) (interface{}, interface{}, map[string]interface{}) {
-	dataCopy, dataScalar, flatFields := deStructValue(dataValue.Elem())
+func (ds *deStructor) deStructPointer(dataValue reflect.Value) (interface{}, interface{}, flatMap) {
+	if !dataValue.IsNil() {
+		visitKey, ok := ds.enter(dataValue)
+		if !ok {
+			return CyclePlaceholder, CyclePlaceholder, flatMap{}
+		}
+		defer ds.leave(visitKey)
+	}
+
+	dataCopy, dataScalar, flatFields := ds.deStructValue(dataValue.Elem())
 	// this is since the original value was a pointer, for the copy we return a pointer as well
 	// We can't just `return &dataCopy` as `dataCopy` is an `interface{}`, so this would return a pointer to an interface rather than a pointer to the copy itself
 	dataCopyValue := reflect.ValueOf(dataCopy)
@@ -73,96 +251,272 @@ func deStructPointer(dataValue reflect.Value) (interface{}, interface{}, map[str
 	}
 	return dataCopyPtr, dataScalar, flatFields
 }
-func deStructInterface(dataValue reflect.Value) (interface{}, interface{}, map[string]interface{}) {
-	return deStructValue(dataValue.Elem())
+func (ds *deStructor) deStructInterface(dataValue reflect.Value) (interface{}, interface{}, flatMap) {
+	return ds.deStructValue(dataValue.Elem())
+}
+
+// structField describes how a single struct field is handled, as determined by its struct tag.
+//
+// The tag format is `sawmill:"name,option,option"`. A name of "-" excludes the field. The options are:
+//  omitempty - exclude the field if it is the zero value.
+//  redact    - replace the value with RedactedValue.
+//  flatten   - merge the fields of a nested struct or map into the parent, without prefixing them with the field name.
+type structField struct {
+	index     int
+	key       string
+	omitEmpty bool
+	redact    bool
+	flatten   bool
+}
+
+type structFieldsCacheKey struct {
+	structType   reflect.Type
+	jsonFallback bool
 }
-func deStructStruct(dataValue reflect.Value) (interface{}, interface{}, map[string]interface{}) {
-	newData := make(map[string]interface{})
-	flatData := make(map[string]interface{})
 
-	structType := reflect.TypeOf(dataValue.Interface())
-	for i := 0; i < dataValue.NumField(); i++ {
-		subDataValue := dataValue.Field(i)
-		if !subDataValue.CanInterface() { // skip if it's unexported
+var structFieldsCache = map[structFieldsCacheKey][]structField{}
+var structFieldsCacheMutex sync.RWMutex
+
+// getStructFields returns the handling of each field in the struct type, excluding unexported fields and those tagged with "-".
+// Results are cached, as reflection on struct tags is relatively expensive.
+func getStructFields(structType reflect.Type) []structField {
+	cacheKey := structFieldsCacheKey{structType, StructTagJSONFallback}
+	structFieldsCacheMutex.RLock()
+	fields, ok := structFieldsCache[cacheKey]
+	structFieldsCacheMutex.RUnlock()
+	if ok {
+		return fields
+	}
+
+	fields = []structField{}
+	for i := 0; i < structType.NumField(); i++ {
+		fieldType := structType.Field(i)
+		if fieldType.PkgPath != "" { // skip if it's unexported
 			continue
 		}
 
-		key := structType.Field(i).Name
+		field := structField{index: i, key: fieldType.Name}
 
-		fieldCopy, fieldScalar, fieldMap := deStructValue(subDataValue)
-		newData[key] = fieldCopy
+		tag, ok := fieldType.Tag.Lookup("sawmill")
+		isJSON := false
+		if !ok && cacheKey.jsonFallback {
+			tag, ok = fieldType.Tag.Lookup("json")
+			isJSON = true
+		}
+		if ok {
+			tagParts := strings.Split(tag, ",")
+			if tagParts[0] == "-" && len(tagParts) == 1 {
+				continue
+			}
+			if tagParts[0] != "" {
+				field.key = tagParts[0]
+			}
+			for _, option := range tagParts[1:] {
+				switch option {
+				case "omitempty":
+					field.omitEmpty = true
+				case "redact":
+					field.redact = !isJSON
+				case "flatten":
+					field.flatten = !isJSON
+				}
+			}
+		}
+
+		fields = append(fields, field)
+	}
 
-		if fieldScalar != nil {
-			flatData[key] = fieldScalar
+	structFieldsCacheMutex.Lock()
+	structFieldsCache[cacheKey] = fields
+	structFieldsCacheMutex.Unlock()
+
+	return fields
+}
+
+// isEmptyValue returns whether the value is considered empty for the `omitempty` struct tag option.
+// The rules are the same as encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func (ds *deStructor) deStructStruct(dataValue reflect.Value) (interface{}, interface{}, flatMap) {
+	if !ds.enterContainer() {
+		return MaxDepthPlaceholder, MaxDepthPlaceholder, flatMap{}
+	}
+	defer ds.leaveContainer()
+
+	structFields := getStructFields(dataValue.Type())
+	newData := make(map[string]interface{}, len(structFields))
+	flatData := ds.newFlatMap(len(structFields))
+
+	for _, field := range structFields {
+		if ds.full() {
+			break
 		}
-		for fieldMapKey, fieldMapValue := range fieldMap {
-			flatData[key+"."+fieldMapKey] = fieldMapValue
+
+		subDataValue := dataValue.Field(field.index)
+		key := field.key
+
+		if field.omitEmpty && isEmptyValue(subDataValue) {
+			continue
 		}
+
+		if field.redact {
+			newData[key] = RedactedValue
+			ds.addFlat(&flatData, key, RedactedValue, flatMap{})
+			continue
+		}
+
+		fieldCopy, fieldScalar, fieldMap := ds.deStructValue(subDataValue)
+
+		if field.flatten && fieldScalar == nil {
+			fieldCopyValue := reflect.Indirect(reflect.ValueOf(fieldCopy))
+			if fieldCopyValue.Kind() == reflect.Map {
+				for _, subKey := range fieldCopyValue.MapKeys() {
+					newData[fmt.Sprintf("%v", subKey.Interface())] = fieldCopyValue.MapIndex(subKey).Interface()
+				}
+				for _, fieldMapKey := range fieldMap.keys {
+					flatData.set(fieldMapKey, fieldMap.values[fieldMapKey])
+				}
+				continue
+			}
+		}
+
+		newData[key] = fieldCopy
+		ds.addFlat(&flatData, key, fieldScalar, fieldMap)
 	}
 
 	return newData, nil, flatData
 }
-func deStructMap(dataValue reflect.Value) (interface{}, interface{}, map[string]interface{}) {
-	newData := make(map[interface{}]interface{})
-	flatData := make(map[string]interface{})
+func (ds *deStructor) deStructMap(dataValue reflect.Value) (interface{}, interface{}, flatMap) {
+	if !dataValue.IsNil() {
+		visitKey, ok := ds.enter(dataValue)
+		if !ok {
+			return CyclePlaceholder, CyclePlaceholder, flatMap{}
+		}
+		defer ds.leave(visitKey)
+	}
+	if !ds.enterContainer() {
+		return MaxDepthPlaceholder, MaxDepthPlaceholder, flatMap{}
+	}
+	defer ds.leaveContainer()
 
-	for _, keyValue := range dataValue.MapKeys() {
-		subDataValue := dataValue.MapIndex(keyValue)
-		keyInterface, _, _ := deStructValue(keyValue) // TODO just use `fmt.Sprintf("%v", keyValue)`?
-		key := fmt.Sprintf("%v", keyInterface)
+	// No more entries are walked than there is room left for under MaxFlatFields.
+	// Which entries are kept when the map doesn't fit is arbitrary, but walking the whole of a huge map is avoided.
+	length := dataValue.Len()
+	if MaxFlatFields > 0 && length > MaxFlatFields-ds.flatCount {
+		length = MaxFlatFields - ds.flatCount
+		if length < 0 {
+			length = 0
+		}
+		ds.truncated = true
+	}
 
-		fieldCopy, fieldScalar, fieldMap := deStructValue(subDataValue)
-		newData[keyInterface] = fieldCopy
+	newData := make(map[interface{}]interface{}, length)
+	flatData := ds.newFlatMap(length)
 
-		if fieldScalar != nil {
-			flatData[key] = fieldScalar
-		}
-		for fieldMapKey, fieldMapValue := range fieldMap {
-			flatData[key+"."+fieldMapKey] = fieldMapValue
+	// maps have no order, so sort the keys for consistent output
+	type mapKey struct {
+		value        reflect.Value
+		key          string
+		keyInterface interface{}
+	}
+	mapKeys := make([]mapKey, 0, length)
+	for iter := dataValue.MapRange(); len(mapKeys) < length && iter.Next(); {
+		keyValue := iter.Key()
+		keyInterface, _, _ := ds.deStructValue(keyValue) // TODO just use `fmt.Sprintf("%v", keyValue)`?
+		mapKeys = append(mapKeys, mapKey{keyValue, fmt.Sprintf("%v", keyInterface), keyInterface})
+	}
+	sort.Slice(mapKeys, func(i, j int) bool { return mapKeys[i].key < mapKeys[j].key })
+
+	for _, mk := range mapKeys {
+		if ds.full() {
+			break
 		}
+
+		subDataValue := dataValue.MapIndex(mk.value)
+		keyInterface, key := mk.keyInterface, mk.key
+
+		fieldCopy, fieldScalar, fieldMap := ds.deStructValue(subDataValue)
+		newData[keyInterface] = fieldCopy
+		ds.addFlat(&flatData, key, fieldScalar, fieldMap)
 	}
 
 	return newData, nil, flatData
 }
 
-func deStructSlice(dataValue reflect.Value) (interface{}, interface{}, map[string]interface{}) {
+func (ds *deStructor) deStructSlice(dataValue reflect.Value) (interface{}, interface{}, flatMap) {
 	if dataValue.Kind() == reflect.Uint8 {
 		newDataValue := reflect.MakeSlice(dataValue.Type(), dataValue.Len(), dataValue.Cap())
 		newDataValue = reflect.AppendSlice(newDataValue, dataValue)
-		return newDataValue.Interface(), newDataValue.Interface(), nil
+		return newDataValue.Interface(), newDataValue.Interface(), flatMap{}
+	}
+
+	if dataValue.Kind() == reflect.Slice && !dataValue.IsNil() {
+		visitKey, ok := ds.enter(dataValue)
+		if !ok {
+			return CyclePlaceholder, CyclePlaceholder, flatMap{}
+		}
+		defer ds.leave(visitKey)
+	}
+	if !ds.enterContainer() {
+		return MaxDepthPlaceholder, MaxDepthPlaceholder, flatMap{}
+	}
+	defer ds.leaveContainer()
+
+	length := dataValue.Len()
+	if MaxSliceLength > 0 && length > MaxSliceLength {
+		length = MaxSliceLength
 	}
 
 	//TODO if the type inside the slice is not a struct, recreate the slice with the same definition
-	newData := make([]interface{}, dataValue.Len())
-	flatData := make(map[string]interface{})
-	for i := 0; i < dataValue.Len(); i++ {
+	newData := make([]interface{}, 0, length)
+	flatData := ds.newFlatMap(length)
+	for i := 0; i < length; i++ {
+		if ds.full() {
+			break
+		}
+
 		subDataValue := dataValue.Index(i)
 		key := strconv.Itoa(i)
 
-		fieldCopy, fieldScalar, fieldMap := deStructValue(subDataValue)
-		newData[i] = fieldCopy
-
-		if fieldScalar != nil {
-			flatData[key] = fieldScalar
-		}
-		for fieldMapKey, fieldMapValue := range fieldMap {
-			flatData[key+"."+fieldMapKey] = fieldMapValue
-		}
+		fieldCopy, fieldScalar, fieldMap := ds.deStructValue(subDataValue)
+		newData = append(newData, fieldCopy)
+		ds.addFlat(&flatData, key, fieldScalar, fieldMap)
+	}
+	if omitted := dataValue.Len() - length; omitted > 0 {
+		flatData.set(TruncatedKey, omitted)
 	}
 
 	return newData, nil, flatData
 }
 
-func deStructChan(dataValue reflect.Value) (interface{}, interface{}, map[string]interface{}) {
-	//return nil, fmt.Sprintf("%#v", dataValue.Interface()), map[string]interface{}{}
-	return nil, nil, map[string]interface{}{}
+func (ds *deStructor) deStructChan(dataValue reflect.Value) (interface{}, interface{}, flatMap) {
+	//return nil, fmt.Sprintf("%#v", dataValue.Interface()), flatMap{}
+	return nil, nil, flatMap{}
 }
 
-func deStructFunction(dataValue reflect.Value) (interface{}, interface{}, map[string]interface{}) {
-	//return nil, fmt.Sprintf("%#v", dataValue.Interface()), map[string]interface{}{}
-	return nil, nil, map[string]interface{}{}
+func (ds *deStructor) deStructFunction(dataValue reflect.Value) (interface{}, interface{}, flatMap) {
+	//return nil, fmt.Sprintf("%#v", dataValue.Interface()), flatMap{}
+	return nil, nil, flatMap{}
 }
 
+var deferredType = reflect.TypeOf(&Deferred{})
+
 var scalarConversionMap = map[reflect.Kind]reflect.Type{
 	reflect.Bool:       reflect.TypeOf(true),
 	reflect.Float32:    reflect.TypeOf(float32(0)),
@@ -183,9 +537,9 @@ var scalarConversionMap = map[reflect.Kind]reflect.Type{
 	reflect.String:     reflect.TypeOf(string("")),
 }
 
-func deStructScalar(dataValue reflect.Value) (interface{}, interface{}, map[string]interface{}) {
+func (ds *deStructor) deStructScalar(dataValue reflect.Value) (interface{}, interface{}, flatMap) {
 	if !dataValue.IsValid() {
-		return nil, nil, map[string]interface{}{}
+		return nil, nil, flatMap{}
 	}
 
 	var newData interface{}
@@ -197,5 +551,5 @@ func deStructScalar(dataValue reflect.Value) (interface{}, interface{}, map[stri
 		newData = dataValue.Interface()
 	}
 
-	return dataValue.Interface(), newData, map[string]interface{}{}
+	return dataValue.Interface(), newData, flatMap{}
 }
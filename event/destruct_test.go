@@ -45,6 +45,17 @@ func (be *int64PointerErrorer) Error() string {
 
 var nilPointer *bool
 
+type taggedStruct struct {
+	Name     string `sawmill:"name"`
+	Skip     string `sawmill:"-"`
+	Empty    string `sawmill:"empty,omitempty"`
+	Password string `sawmill:"password,redact"`
+	Inner    struct {
+		Foo string `sawmill:"foo"`
+	} `sawmill:",flatten"`
+	Untagged int
+}
+
 var tests = []test{
 	// {
 	//   input,
@@ -194,30 +205,29 @@ var tests = []test{
 		int64Errorer(1234),
 		int64Errorer(1234),
 		"ERROR",
-		map[string]interface{}{},
+		map[string]interface{}{"type": "event.int64Errorer"},
 	},
 	{
 		func() *int64Errorer { v := int64Errorer(1234); return &v }(),
 		func() *int64Errorer { v := int64Errorer(1234); return &v }(),
 		"ERROR",
-		map[string]interface{}{},
+		map[string]interface{}{"type": "*event.int64Errorer"},
 	},
 	{
 		errors.New("FOO"),
 		&map[string]interface{}{},
 		"FOO",
-		map[string]interface{}{},
+		map[string]interface{}{"type": "*errors.errorString"},
 	},
 	{
 		fmt.Errorf("FOO"),
 		&map[string]interface{}{},
 		"FOO",
-		map[string]interface{}{},
+		map[string]interface{}{"type": "*errors.errorString"},
 	},
 	{
 		net.IPv4(192, 168, 0, 32),
-		//net.IPv4(192, 168, 0, 32), //TODO make it so this is what it actually does do
-		[]interface{}{byte(0), byte(0), byte(0), byte(0), byte(0), byte(0), byte(0), byte(0), byte(0), byte(0), byte(255), byte(255), byte(192), byte(168), byte(0), byte(32)},
+		"192.168.0.32",
 		"192.168.0.32",
 		map[string]interface{}{},
 	},
@@ -232,7 +242,15 @@ var tests = []test{
 		map[string]interface{}{"foo": map[string]int64Errorer{"bar": int64Errorer(1234), "baz": int64Errorer(0)}, "pop": "tart"},
 		map[interface{}]interface{}{"foo": map[interface{}]interface{}{"bar": int64Errorer(1234), "baz": int64Errorer(0)}, "pop": "tart"},
 		nil,
-		map[string]interface{}{"foo.bar": "ERROR", "foo.baz": "ERROR", "pop": "tart"},
+		map[string]interface{}{"foo.bar": "ERROR", "foo.bar.type": "event.int64Errorer", "foo.baz": "ERROR", "foo.baz.type": "event.int64Errorer", "pop": "tart"},
+	},
+	{
+		taggedStruct{Name: "bar", Skip: "skip", Password: "secret", Untagged: 1, Inner: struct {
+			Foo string `sawmill:"foo"`
+		}{"pop"}},
+		map[string]interface{}{"name": "bar", "password": RedactedValue, "foo": "pop", "Untagged": 1},
+		nil,
+		map[string]interface{}{"name": "bar", "password": RedactedValue, "foo": "pop", "Untagged": 1},
 	},
 }
 
@@ -262,6 +280,100 @@ func TestDeStruct(t *testing.T) {
 	}
 }
 
+func TestDeStruct_jsonFallback(t *testing.T) {
+	type jsonStruct struct {
+		Foo    string `json:"foo"`
+		Bar    string `json:"bar,omitempty"`
+		Skip   string `json:"-"`
+		Tagged string `json:"json_tagged" sawmill:"sawmill_tagged"`
+	}
+	input := jsonStruct{Foo: "a", Skip: "b", Tagged: "c"}
+
+	_, _, fields := deStruct(input)
+	assert.Equal(t, map[string]interface{}{"Foo": "a", "Bar": "", "Skip": "b", "sawmill_tagged": "c"}, fields)
+
+	StructTagJSONFallback = true
+	defer func() { StructTagJSONFallback = false }()
+	_, _, fields = deStruct(input)
+	assert.Equal(t, map[string]interface{}{"foo": "a", "sawmill_tagged": "c"}, fields)
+}
+
+type treeNode struct {
+	Name     string
+	Parent   *treeNode
+	Children []*treeNode
+}
+
+func TestDeStruct_cycle(t *testing.T) {
+	root := &treeNode{Name: "root"}
+	child := &treeNode{Name: "child", Parent: root}
+	root.Children = []*treeNode{child}
+
+	_, _, fields := deStruct(root)
+	assert.Equal(t, map[string]interface{}{
+		"Name":              "root",
+		"Children.0.Name":   "child",
+		"Children.0.Parent": CyclePlaceholder,
+	}, fields)
+
+	m := map[string]interface{}{"foo": "bar"}
+	m["self"] = m
+	_, _, fields = deStruct(m)
+	assert.Equal(t, map[string]interface{}{"foo": "bar", "self": CyclePlaceholder}, fields)
+
+	// the same pointer appearing twice, but not in a cycle, must not be treated as a cycle
+	shared := &treeNode{Name: "shared"}
+	_, _, fields = deStruct([]*treeNode{shared, shared})
+	assert.Equal(t, "shared", fields["0.Name"])
+	assert.Equal(t, "shared", fields["1.Name"])
+}
+
+func TestDeStruct_maxDepth(t *testing.T) {
+	defer func(v int) { MaxFieldDepth = v }(MaxFieldDepth)
+	MaxFieldDepth = 2
+
+	input := map[string]interface{}{"a": map[string]interface{}{"b": map[string]interface{}{"c": "d"}}, "e": "f"}
+	_, _, fields := deStruct(input)
+	assert.Equal(t, map[string]interface{}{"a.b": MaxDepthPlaceholder, "e": "f"}, fields)
+}
+
+func TestDeStruct_maxSliceLength(t *testing.T) {
+	defer func(v int) { MaxSliceLength = v }(MaxSliceLength)
+	MaxSliceLength = 2
+
+	dataCopy, _, fields := deStruct([]int{1, 2, 3, 4, 5})
+	assert.Equal(t, []interface{}{1, 2}, dataCopy)
+	assert.Equal(t, map[string]interface{}{"0": 1, "1": 2, TruncatedKey: 3}, fields)
+}
+
+func TestDeStruct_maxFlatFields(t *testing.T) {
+	defer func(v int) { MaxFlatFields = v }(MaxFlatFields)
+	MaxFlatFields = 3
+
+	_, _, fields := deStruct([]int{1, 2, 3, 4, 5})
+	assert.Equal(t, map[string]interface{}{"0": 1, "1": 2, "2": 3, TruncatedKey: true}, fields)
+}
+
+func TestDeStruct_maxFlatFieldsMap(t *testing.T) {
+	defer func(v int) { MaxFlatFields = v }(MaxFlatFields)
+	MaxFlatFields = 3
+
+	input := map[int]int{}
+	for i := 0; i < 1000; i++ {
+		input[i] = i
+	}
+	dataCopy, _, fields := deStruct(map[string]interface{}{"a": 1, "m": input})
+	assert.Len(t, dataCopy.(map[interface{}]interface{})["m"], 2)
+	assert.Len(t, fields, 4)
+	assert.Equal(t, 1, fields["a"])
+	assert.Equal(t, true, fields[TruncatedKey])
+}
+
+func TestDeStruct_order(t *testing.T) {
+	logEvent := New(1, Info, "test", map[string]interface{}{"b": map[string]interface{}{"d": 1, "c": 2}, "a": errors.New("e")}, false)
+	assert.Equal(t, []string{"a", "a.type", "b.c", "b.d"}, logEvent.FieldOrder)
+}
+
 func BenchmarkDeStruct(b *testing.B) {
 	var outputCopy interface{}
 	var outputScalar interface{}
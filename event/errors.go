@@ -0,0 +1,110 @@
+package event
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// errorChainMaxLength is the maximum number of errors walked in a chain of wrapped errors.
+// This guards against an error which (incorrectly) unwraps to itself.
+var errorChainMaxLength = 100
+
+// StackTracer is implemented by errors which carry the stack trace of where they were created.
+// If an event is logged with such an error and the logger did not capture a stack trace, the error's stack is used as the event's Stack.
+//
+// The returned values are program counters, as returned by runtime.Callers().
+//
+// Errors from github.com/pkg/errors are also supported, via their `StackTrace()` method.
+type StackTracer interface {
+	Callers() []uintptr
+}
+
+// errorFields returns the nested attributes for an error.
+//
+// The attributes are:
+//  type - The concrete Go type of the error (e.g. "*os.PathError").
+//  chain.N.type - The type of each error in the chain of wrapped errors, starting with the error itself.
+//  chain.N.message - The message of each error in the chain.
+// The chain is only included if the error wraps other errors. Errors are unwrapped with `Unwrap() error`, `Unwrap() []error` (errors.Join), and `Cause() error` (github.com/pkg/errors).
+//
+// If any error in the chain carries a stack trace, the deepest one is recorded on the deStructor.
+func (ds *deStructor) errorFields(err error) flatMap {
+	chain := errorChain(err, nil)
+
+	fields := newFlatMap(1 + 2*len(chain))
+	fields.set("type", errorType(err))
+	if len(chain) > 1 {
+		for i, chainErr := range chain {
+			prefix := "chain." + strconv.Itoa(i) + "."
+			fields.set(prefix+"type", errorType(chainErr))
+			fields.set(prefix+"message", chainErr.Error())
+		}
+	}
+
+	for _, chainErr := range chain {
+		if stack := errorStack(chainErr); stack != nil {
+			ds.errorStack = stack
+		}
+	}
+
+	return fields
+}
+
+// errorType returns the name of the concrete type of the error.
+func errorType(err error) string {
+	return reflect.TypeOf(err).String()
+}
+
+// errorChain returns the error followed by all the errors it wraps, depth first.
+func errorChain(err error, chain []error) []error {
+	chain = append(chain, err)
+	if len(chain) >= errorChainMaxLength {
+		return chain
+	}
+
+	switch err := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, wrappedErr := range err.Unwrap() {
+			if wrappedErr != nil && len(chain) < errorChainMaxLength {
+				chain = errorChain(wrappedErr, chain)
+			}
+		}
+	case interface{ Unwrap() error }:
+		if wrappedErr := err.Unwrap(); wrappedErr != nil {
+			chain = errorChain(wrappedErr, chain)
+		}
+	case interface{ Cause() error }:
+		if wrappedErr := err.Cause(); wrappedErr != nil {
+			chain = errorChain(wrappedErr, chain)
+		}
+	}
+
+	return chain
+}
+
+// errorStack returns the stack trace carried by the error, if any.
+func errorStack(err error) []uintptr {
+	if stackTracer, ok := err.(StackTracer); ok {
+		return stackTracer.Callers()
+	}
+
+	// github.com/pkg/errors provides `StackTrace() errors.StackTrace`, where StackTrace is a []Frame, and Frame is a uintptr.
+	// Use reflection so we don't have to import the package.
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() {
+		return nil
+	}
+	methodType := method.Type()
+	if methodType.NumIn() != 0 || methodType.NumOut() != 1 {
+		return nil
+	}
+	if outType := methodType.Out(0); outType.Kind() != reflect.Slice || outType.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	frames := method.Call(nil)[0]
+	stack := make([]uintptr, frames.Len())
+	for i := range stack {
+		stack[i] = uintptr(frames.Index(i).Uint())
+	}
+	return stack
+}
@@ -0,0 +1,103 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stackError struct {
+	msg     string
+	callers []uintptr
+}
+
+func newStackError(msg string) *stackError {
+	callers := make([]uintptr, 10)
+	n := runtime.Callers(2, callers)
+	return &stackError{msg: msg, callers: callers[:n]}
+}
+func (se *stackError) Error() string      { return se.msg }
+func (se *stackError) Callers() []uintptr { return se.callers }
+
+// pkgError mimics the github.com/pkg/errors stack trace interface.
+type pkgFrame uintptr
+type pkgStackTrace []pkgFrame
+type pkgError struct {
+	stack []uintptr
+}
+
+func (pe *pkgError) Error() string { return "pkg" }
+func (pe *pkgError) StackTrace() pkgStackTrace {
+	st := make(pkgStackTrace, len(pe.stack))
+	for i, pc := range pe.stack {
+		st[i] = pkgFrame(pc)
+	}
+	return st
+}
+
+func TestErrorFields(t *testing.T) {
+	_, scalar, fields := deStruct(map[string]interface{}{"error": errors.New("foo")})
+	assert.Nil(t, scalar)
+	assert.Equal(t, map[string]interface{}{"error": "foo", "error.type": "*errors.errorString"}, fields)
+}
+
+func TestErrorFields_chain(t *testing.T) {
+	baseErr := errors.New("base")
+	err := fmt.Errorf("outer: %w", baseErr)
+
+	_, _, fields := deStruct(map[string]interface{}{"error": err})
+	assert.Equal(t, map[string]interface{}{
+		"error":                 "outer: base",
+		"error.type":            "*fmt.wrapError",
+		"error.chain.0.type":    "*fmt.wrapError",
+		"error.chain.0.message": "outer: base",
+		"error.chain.1.type":    "*errors.errorString",
+		"error.chain.1.message": "base",
+	}, fields)
+}
+
+func TestErrorFields_join(t *testing.T) {
+	err := errors.Join(errors.New("a"), fmt.Errorf("b: %w", errors.New("c")))
+
+	_, _, fields := deStruct(map[string]interface{}{"error": err})
+	assert.Equal(t, "*errors.joinError", fields["error.chain.0.type"])
+	assert.Equal(t, "a", fields["error.chain.1.message"])
+	assert.Equal(t, "b: c", fields["error.chain.2.message"])
+	assert.Equal(t, "c", fields["error.chain.3.message"])
+}
+
+// makeStackError creates the error in its own function, so that the error's stack can be told apart from the one captured by New().
+func makeStackError() error {
+	return newStackError("foo")
+}
+
+func TestNew_errorStack(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", makeStackError())
+
+	logEvent := New(1, Error, "test", map[string]interface{}{"error": err}, false)
+	require.NotEmpty(t, logEvent.Stack)
+	assert.Equal(t, "makeStackError", logEvent.Stack[0].Func)
+
+	// a captured stack takes precedence
+	logEvent = New(1, Error, "test", map[string]interface{}{"error": err}, true)
+	require.NotEmpty(t, logEvent.Stack)
+	for _, frame := range logEvent.Stack {
+		assert.NotEqual(t, "makeStackError", frame.Func)
+	}
+
+	// no error, no stack
+	logEvent = New(1, Error, "test", map[string]interface{}{"foo": "bar"}, false)
+	assert.Empty(t, logEvent.Stack)
+}
+
+func TestNew_errorStackPkgErrors(t *testing.T) {
+	err := &pkgError{stack: newStackError("").callers}
+
+	logEvent := New(1, Error, "test", map[string]interface{}{"error": err}, false)
+	require.NotEmpty(t, logEvent.Stack)
+	assert.Equal(t, "TestNew_errorStackPkgErrors", logEvent.Stack[0].Func)
+}
@@ -6,6 +6,7 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -38,37 +39,6 @@ func init() {
 	RepoPath = path.Dir(RepoPath)
 }
 
-type Level int
-
-const (
-	Debug, Dbg Level = iota, iota
-	Info, _
-	Notice, _
-	Warning, Warn
-	Error, Err
-	Critical, Crit
-	Alert, Alrt
-	Emergency, Emerg
-)
-
-var levelNames = [8]string{
-	"debug",
-	"info",
-	"notice",
-	"warning",
-	"error",
-	"critical",
-	"alert",
-	"emergency",
-}
-
-func (l Level) String() string {
-	return levelNames[l]
-}
-func (l Level) Int() int {
-	return int(l)
-}
-
 type Event struct {
 	Id         uint64
 	Level      Level
@@ -76,20 +46,48 @@ type Event struct {
 	Message    string
 	Fields     interface{}
 	FlatFields map[string]interface{}
+	// FieldOrder is the keys of FlatFields in the order the fields were provided. Struct fields are in the order they were declared, and map keys are sorted.
+	// It may be out of date if FlatFields has been modified, such as by a transform handler.
+	FieldOrder []string
 	Stack      []*StackFrame
+	Caller     *StackFrame
+
+	refs   int32 // reference count, see Retain() & Release()
+	pooled bool  // whether the event came from the pool
 }
 
 // StackFrame describes an entry in a call stack.
+// Stack frames are shared between events, and must not be modified.
 type StackFrame struct {
-	PC       uintptr
-	File     string
-	Line     int
-	Function string
-	Func     string
-	Package  string
+	PC       uintptr `json:"pc"`
+	File     string  `json:"file"`
+	Line     int     `json:"line"`
+	Function string  `json:"function"`
+	Func     string  `json:"func"`
+	Package  string  `json:"package"`
 }
 
+var stackFrameCache = map[uintptr]*StackFrame{}
+var stackFrameCacheMutex sync.RWMutex
+
+// newStackFrame returns the stack frame for the given program counter.
+// Frames are cached, as resolving the function, file & line is expensive, and the same call sites log over and over.
 func newStackFrame(pc uintptr) *StackFrame {
+	stackFrameCacheMutex.RLock()
+	frame, ok := stackFrameCache[pc]
+	stackFrameCacheMutex.RUnlock()
+	if ok {
+		return frame
+	}
+
+	frame = resolveStackFrame(pc)
+	stackFrameCacheMutex.Lock()
+	stackFrameCache[pc] = frame
+	stackFrameCacheMutex.Unlock()
+	return frame
+}
+
+func resolveStackFrame(pc uintptr) *StackFrame {
 	f := runtime.FuncForPC(pc)
 	if f == nil {
 		return nil
@@ -101,6 +99,10 @@ func newStackFrame(pc uintptr) *StackFrame {
 	linePC := pc
 	if linePC > f.Entry() {
 		linePC--
+		// When the call was inlined, the return address can belong to a different function than the call instruction.
+		if f = runtime.FuncForPC(linePC); f == nil {
+			return nil
+		}
 	}
 
 	file, line := f.FileLine(linePC)
@@ -159,7 +161,8 @@ func (sf *StackFrame) SourceContext(beforeCount int, afterCount int) (linesBefor
 		if i < firstLine {
 			continue
 		}
-		lines = append(lines, scanner.Bytes())
+		// the scanner reuses its buffer, so the line must be copied
+		lines = append(lines, append([]byte{}, scanner.Bytes()...))
 	}
 	file.Close()
 
@@ -177,39 +180,89 @@ func (sf *StackFrame) SourceContext(beforeCount int, afterCount int) (linesBefor
 
 // New creates a new Event object.
 // The time is set to current time, and the fields are deep-copied.
+//
+// If getStack is false, but the fields contain an error carrying a stack trace (see StackTracer), the error's stack trace is used.
 func New(id uint64, level Level, message string, fields interface{}, getStack bool) *Event {
+	logEvent := &Event{}
+	newEvent(logEvent, id, level, message, fields, getStack)
+	return logEvent
+}
+
+// newEvent populates logEvent from the fields.
+// If logEvent already has a FlatFields map, it is expected to be empty, and is reused.
+func newEvent(logEvent *Event, id uint64, level Level, message string, fields interface{}, getStack bool) {
 	now := time.Now()
 
 	var stack []*StackFrame
 	if getStack {
-		callers := make([]uintptr, stackMaxDepth)
-		n := runtime.Callers(1, callers)
-		callers = callers[:n]
-		for i, caller := range callers {
-			f := runtime.FuncForPC(caller)
-			if file, _ := f.FileLine(caller); strings.HasPrefix(file, RepoPath) {
-				continue
-			}
-			callers = callers[i:]
-			break
-		}
-		stack = make([]*StackFrame, len(callers))
-		for i, caller := range callers {
-			stack[i] = newStackFrame(caller)
-		}
+		stack = captureStack()
 	}
 
-	fieldsCopy, _, flatFields := deStruct(fields)
+	ds := &deStructor{}
+	if logEvent.FlatFields != nil {
+		ds.recycled = &flatMap{values: logEvent.FlatFields, keys: logEvent.FieldOrder[:0]}
+	}
+	fieldsCopy, _, flatFields := ds.deStruct(fields)
+
+	if stack == nil && ds.errorStack != nil {
+		// the logger didn't capture a stack, but an error in the fields carried one
+		stack = stackFrames(ds.errorStack)
+	}
 
-	event := &Event{
-		Id:         id,
-		Time:       now,
-		Level:      level,
-		Message:    message,
-		Fields:     fieldsCopy,
-		FlatFields: flatFields,
-		Stack:      stack,
+	logEvent.Id = id
+	logEvent.Time = now
+	logEvent.Level = level
+	logEvent.Message = message
+	logEvent.Fields = fieldsCopy
+	logEvent.FlatFields = flatFields.values
+	logEvent.FieldOrder = flatFields.keys
+	logEvent.Stack = stack
+	logEvent.Caller = nil
+	if getStack && len(stack) > 0 {
+		logEvent.Caller = stack[0]
 	}
+}
 
-	return event
+// captureStack obtains the current call stack, starting from the first frame outside of RepoPath.
+func captureStack() []*StackFrame {
+	callers := make([]uintptr, stackMaxDepth)
+	n := runtime.Callers(1, callers)
+	callers = callers[:n]
+	stack := make([]*StackFrame, 0, len(callers))
+	for _, caller := range callers {
+		frame := newStackFrame(caller)
+		if len(stack) == 0 && frame != nil && strings.HasPrefix(frame.File, RepoPath) {
+			continue
+		}
+		stack = append(stack, frame)
+	}
+	return stack
+}
+
+// CaptureCaller returns the stack frame of the first caller outside of RepoPath. This is the same frame which begins the stack captured by New().
+// It is far cheaper than capturing the whole stack, as only the frames up to the caller are resolved.
+//
+// Returns nil if the caller cannot be determined.
+func CaptureCaller() *StackFrame {
+	var callers [32]uintptr
+	n := runtime.Callers(1, callers[:])
+	for _, caller := range callers[:n] {
+		frame := newStackFrame(caller)
+		if frame == nil || strings.HasPrefix(frame.File, RepoPath) {
+			continue
+		}
+		return frame
+	}
+	return nil
+}
+
+// stackFrames converts program counters into stack frames, skipping any which cannot be resolved.
+func stackFrames(callers []uintptr) []*StackFrame {
+	stack := make([]*StackFrame, 0, len(callers))
+	for _, caller := range callers {
+		if frame := newStackFrame(caller); frame != nil {
+			stack = append(stack, frame)
+		}
+	}
+	return stack
 }
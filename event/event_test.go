@@ -87,3 +87,18 @@ func TestNew_Stack(t *testing.T) {
 	require.NotNil(t, frame1)
 	assert.Equal(t, file, frame1.File)
 }
+
+func TestCaptureCaller(t *testing.T) {
+	// Same trick as TestNew_Stack, treat only this package as internal.
+	repoPathBkup := RepoPath
+	RepoPath = FilePath
+	defer func() { RepoPath = repoPathBkup }()
+
+	caller := CaptureCaller()
+	_, file, line, _ := runtime.Caller(0)
+
+	require.NotNil(t, caller)
+	assert.Equal(t, file, caller.File)
+	assert.Equal(t, line-1, caller.Line)
+	assert.Equal(t, "TestCaptureCaller", caller.Func)
+}
@@ -0,0 +1,100 @@
+package event
+
+import (
+	"reflect"
+	"time"
+)
+
+// Field is a single key/value pair for an event.
+// Events generated from fields with NewWithFields() avoid the reflection needed to copy arbitrary data, as long as the value is one of the basic types listed in NewWithFields().
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// SawmillValue returns the field as a single entry map. This satisfies the Valuer interface, so that fields passed alongside other data are still logged sensibly.
+func (field Field) SawmillValue() interface{} {
+	return map[string]interface{}{field.Key: field.Value}
+}
+
+// NewWithFields creates a new Event object from a list of fields.
+// It is equivalent to calling New() with a map of the fields, but faster.
+//
+// Values of type string, bool, int, int64, uint64, float64, time.Duration, time.Time, and error are copied without reflection. Other values are copied the same as New() would.
+func NewWithFields(id uint64, level Level, message string, fields []Field, getStack bool) *Event {
+	logEvent := &Event{}
+	newWithFields(logEvent, id, level, message, fields, getStack)
+	return logEvent
+}
+
+// newWithFields populates logEvent from the list of fields.
+// If logEvent already has a FlatFields map, it is expected to be empty, and is reused.
+func newWithFields(logEvent *Event, id uint64, level Level, message string, fields []Field, getStack bool) {
+	now := time.Now()
+
+	var stack []*StackFrame
+	if getStack {
+		stack = captureStack()
+	}
+
+	ds := &deStructor{}
+	// reused from a pooled event
+	flatFields := flatMap{values: logEvent.FlatFields, keys: logEvent.FieldOrder[:0]}
+	if flatFields.values == nil {
+		flatFields = newFlatMap(len(fields))
+	}
+	fieldsCopy := ds.deStructFields(fields, &flatFields)
+	if ds.truncated {
+		flatFields.set(TruncatedKey, true)
+	}
+
+	if stack == nil && ds.errorStack != nil {
+		stack = stackFrames(ds.errorStack)
+	}
+
+	logEvent.Id = id
+	logEvent.Time = now
+	logEvent.Level = level
+	logEvent.Message = message
+	logEvent.Fields = fieldsCopy
+	logEvent.FlatFields = flatFields.values
+	logEvent.FieldOrder = flatFields.keys
+	logEvent.Stack = stack
+	logEvent.Caller = nil
+	if getStack && len(stack) > 0 {
+		logEvent.Caller = stack[0]
+	}
+}
+
+var fieldSliceType = reflect.TypeOf([]Field(nil))
+
+// deStructFields copies a list of fields, adding their flattened values to flatFields in the order given.
+func (ds *deStructor) deStructFields(fields []Field, flatFields *flatMap) map[string]interface{} {
+	fieldsCopy := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		key := field.Key
+		switch value := field.Value.(type) {
+		case string, bool, int, int64, uint64, float64:
+			fieldsCopy[key] = value
+			flatFields.set(key, value)
+		case time.Duration:
+			fieldsCopy[key] = value
+			flatFields.set(key, value.String())
+		case time.Time:
+			fieldsCopy[key] = value
+			flatFields.set(key, value.String())
+		case error:
+			fieldsCopy[key] = value
+			flatFields.set(key, value.Error())
+			errorFields := ds.errorFields(value)
+			for _, subKey := range errorFields.keys {
+				flatFields.set(key+"."+subKey, errorFields.values[subKey])
+			}
+		default:
+			fieldCopy, fieldScalar, fieldMap := ds.deStructValue(reflect.ValueOf(value))
+			fieldsCopy[key] = fieldCopy
+			ds.addFlat(flatFields, key, fieldScalar, fieldMap)
+		}
+	}
+	return fieldsCopy
+}
@@ -0,0 +1,74 @@
+package event
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithFields(t *testing.T) {
+	now := time.Now()
+	err := errors.New("foo")
+	fields := []Field{
+		{"string", "bar"},
+		{"int", 1},
+		{"dur", time.Second},
+		{"time", now},
+		{"error", err},
+		{"any", map[string]interface{}{"pop": "tart"}},
+	}
+	logEvent := NewWithFields(1, Info, "test", fields, false)
+
+	assert.Equal(t, map[string]interface{}{
+		"string":     "bar",
+		"int":        1,
+		"dur":        "1s",
+		"time":       now.String(),
+		"error":      "foo",
+		"error.type": "*errors.errorString",
+		"any.pop":    "tart",
+	}, logEvent.FlatFields)
+
+	fieldsCopy := logEvent.Fields.(map[string]interface{})
+	assert.Equal(t, time.Second, fieldsCopy["dur"])
+	assert.Equal(t, now, fieldsCopy["time"])
+	assert.Equal(t, map[interface{}]interface{}{"pop": "tart"}, fieldsCopy["any"])
+}
+
+// TestNewWithFields_equivalent checks that typed fields produce the same flat fields as a plain map.
+func TestNewWithFields_equivalent(t *testing.T) {
+	fields := []Field{{"a", "b"}, {"c", 3}, {"d", 2 * time.Millisecond}, {"e", errors.New("f")}}
+	fieldsMap := map[string]interface{}{}
+	for _, field := range fields {
+		fieldsMap[field.Key] = field.Value
+	}
+
+	assert.Equal(t, New(1, Info, "test", fieldsMap, false).FlatFields, NewWithFields(1, Info, "test", fields, false).FlatFields)
+}
+
+func TestFieldOrder(t *testing.T) {
+	// typed fields keep the order given
+	e := NewWithFields(1, Info, "testing", []Field{{"method", "GET"}, {"path", "/foo"}, {"status", 200}, {"nested", map[string]int{"b": 2, "a": 1}}}, false)
+	assert.Equal(t, []string{"method", "path", "status", "nested.a", "nested.b"}, e.FieldOrder)
+
+	// struct fields are in declaration order
+	type request struct {
+		Method string
+		Path   string
+		Inner  struct{ Z, Y int }
+		Status int
+	}
+	e = New(1, Info, "testing", request{Method: "GET"}, false)
+	assert.Equal(t, []string{"Method", "Path", "Inner.Z", "Inner.Y", "Status"}, e.FieldOrder)
+
+	// maps are sorted
+	e = New(1, Info, "testing", map[string]interface{}{"c": 1, "a": 2, "b": 3}, false)
+	assert.Equal(t, []string{"a", "b", "c"}, e.FieldOrder)
+
+	// a list of fields is an ordered map
+	e = New(1, Info, "testing", []Field{{"z", 1}, {"y", 2}}, false)
+	assert.Equal(t, []string{"z", "y"}, e.FieldOrder)
+	assert.Equal(t, map[string]interface{}{"z": 1, "y": 2}, e.Fields)
+}
@@ -0,0 +1,255 @@
+package formatter
+
+import (
+	"strconv"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// ColorLevel is the level of color support of a terminal.
+type ColorLevel int
+
+const (
+	// ColorNone disables color.
+	ColorNone ColorLevel = iota - 1
+	// ColorBasic is the 16 standard ANSI colors. As the zero value, it is the default.
+	ColorBasic
+	// Color256 is the xterm 256 color palette.
+	Color256
+	// ColorTrue is 24-bit RGB color.
+	ColorTrue
+)
+
+type colorKind uint8
+
+const (
+	colorKindNone colorKind = iota
+	colorKindBasic
+	colorKind256
+	colorKindRGB
+	colorKindLevel
+)
+
+// Color is a color used for terminal output.
+// Colors are converted to the nearest available color when the terminal does not support them, e.g. an RGB color is shown as one of the 256 colors.
+//
+// The zero value is no color.
+type Color struct {
+	kind    colorKind
+	n       uint8
+	r, g, b uint8
+	bold    bool
+}
+
+// The basic ANSI colors.
+var (
+	Black   = BasicColor(0)
+	Red     = BasicColor(1)
+	Green   = BasicColor(2)
+	Yellow  = BasicColor(3)
+	Blue    = BasicColor(4)
+	Magenta = BasicColor(5)
+	Cyan    = BasicColor(6)
+	White   = BasicColor(7)
+	Gray    = BasicColor(8)
+)
+
+// LevelColor may be used for Theme.Key & Theme.Value to use the color of the event's level.
+var LevelColor = Color{kind: colorKindLevel}
+
+// BasicColor returns one of the 16 basic ANSI colors. 0-7 are the normal colors (black, red, green, yellow, blue, magenta, cyan, white), and 8-15 are their bright variants.
+func BasicColor(n int) Color {
+	return Color{kind: colorKindBasic, n: uint8(n & 15)}
+}
+
+// PaletteColor returns one of the xterm 256 colors.
+func PaletteColor(n int) Color {
+	return Color{kind: colorKind256, n: uint8(n)}
+}
+
+// RGBColor returns a 24-bit color.
+func RGBColor(r, g, b uint8) Color {
+	return Color{kind: colorKindRGB, r: r, g: g, b: b}
+}
+
+// Bold returns the same color, in bold.
+func (c Color) Bold() Color {
+	c.bold = true
+	return c
+}
+
+// rgb returns the approximate RGB value of the color.
+func (c Color) rgb() (uint8, uint8, uint8) {
+	switch c.kind {
+	case colorKindRGB:
+		return c.r, c.g, c.b
+	case colorKind256:
+		if c.n < 16 {
+			return BasicColor(int(c.n)).rgb()
+		}
+		if c.n >= 232 {
+			v := uint8(8 + 10*(int(c.n)-232))
+			return v, v, v
+		}
+		i := int(c.n) - 16
+		return uint8(cubeLevels[i/36]), uint8(cubeLevels[i/6%6]), uint8(cubeLevels[i%6])
+	case colorKindBasic:
+		v := uint8(0xcd)
+		if c.n >= 8 {
+			v = 0xff
+		}
+		if c.n == 8 {
+			return 0x7f, 0x7f, 0x7f
+		}
+		var r, g, b uint8
+		if c.n&1 != 0 {
+			r = v
+		}
+		if c.n&2 != 0 {
+			g = v
+		}
+		if c.n&4 != 0 {
+			b = v
+		}
+		return r, g, b
+	}
+	return 0, 0, 0
+}
+
+// downgrade converts the color to one supported by the given level.
+func (c Color) downgrade(level ColorLevel) Color {
+	switch {
+	case c.kind == colorKindRGB && level < ColorTrue,
+		c.kind == colorKind256 && level < Color256:
+	default:
+		return c
+	}
+
+	r, g, b := c.rgb()
+	if level == Color256 {
+		return Color{kind: colorKind256, n: uint8(16 + 36*cubeIndex(r) + 6*cubeIndex(g) + cubeIndex(b)), bold: c.bold}
+	}
+
+	min, max := r, r
+	for _, v := range []uint8{g, b} {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	var n uint8
+	if max-min < 0x20 {
+		// shades of gray
+		switch {
+		case max < 0x40:
+			n = 0 // black
+		case max < 0xa0:
+			n = 8 // gray
+		case max < 0xe0:
+			n = 7 // white
+		default:
+			n = 15 // bright white
+		}
+	} else {
+		for i, v := range []uint8{r, g, b} {
+			if v > max/2 {
+				n |= 1 << uint(i)
+			}
+		}
+		if max > 0xdf {
+			n += 8
+		}
+	}
+	return Color{kind: colorKindBasic, n: n, bold: c.bold}
+}
+
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// cubeIndex returns the index of the nearest level of the 256 color cube.
+func cubeIndex(v uint8) int {
+	index := 0
+	for i, level := range cubeLevels {
+		if abs(int(v)-level) < abs(int(v)-cubeLevels[index]) {
+			index = i
+		}
+	}
+	return index
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// Sequence returns the ANSI escape sequence which starts the color, converted for the given color support level.
+// An empty string is returned for no color, or if level is ColorNone.
+func (c Color) Sequence(level ColorLevel) string {
+	if level == ColorNone || c.kind == colorKindNone || c.kind == colorKindLevel {
+		return ""
+	}
+	c = c.downgrade(level)
+
+	seq := "\x1b["
+	if c.bold {
+		seq += "1;"
+	}
+	switch c.kind {
+	case colorKindBasic:
+		if c.n < 8 {
+			seq += "3" + strconv.Itoa(int(c.n))
+		} else {
+			seq += "9" + strconv.Itoa(int(c.n)-8)
+		}
+	case colorKind256:
+		seq += "38;5;" + strconv.Itoa(int(c.n))
+	case colorKindRGB:
+		seq += "38;2;" + strconv.Itoa(int(c.r)) + ";" + strconv.Itoa(int(c.g)) + ";" + strconv.Itoa(int(c.b))
+	}
+	return seq + "m"
+}
+
+const colorReset = "\x1b[0m"
+
+// Theme is the set of colors used by a Formatter.
+type Theme struct {
+	// Levels is the color of each standard level, indexed by level (event.Debug through event.Emergency). Other levels use the color of their standard level.
+	Levels [8]Color
+	// Key is the color of field keys.
+	Key Color
+	// Value is the color of field values.
+	Value Color
+}
+
+// DefaultTheme is the theme used by formatters which have not been given one.
+var DefaultTheme = &Theme{
+	Levels: [8]Color{
+		event.Debug:     Gray,
+		event.Info:      Cyan,
+		event.Notice:    Cyan,
+		event.Warning:   Yellow,
+		event.Error:     Red,
+		event.Critical:  Red.Bold(),
+		event.Alert:     Red.Bold(),
+		event.Emergency: Red.Bold(),
+	},
+	Key: LevelColor,
+}
+
+// levelColor returns the theme's color for the given level.
+func (theme *Theme) levelColor(level event.Level) Color {
+	return theme.Levels[level.Standard()]
+}
+
+// colorize wraps text in the escape sequences for the color.
+func colorize(color Color, level ColorLevel, text string) string {
+	seq := color.Sequence(level)
+	if seq == "" {
+		return text
+	}
+	return seq + text + colorReset
+}
@@ -0,0 +1,56 @@
+package formatter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+func TestColor_Sequence(t *testing.T) {
+	assert.Equal(t, "\x1b[31m", Red.Sequence(ColorBasic))
+	assert.Equal(t, "\x1b[1;31m", Red.Bold().Sequence(ColorBasic))
+	assert.Equal(t, "\x1b[90m", Gray.Sequence(ColorTrue))
+	assert.Equal(t, "\x1b[38;5;208m", PaletteColor(208).Sequence(Color256))
+	assert.Equal(t, "\x1b[38;2;255;135;0m", RGBColor(255, 135, 0).Sequence(ColorTrue))
+	assert.Equal(t, "", Red.Sequence(ColorNone))
+	assert.Equal(t, "", Color{}.Sequence(ColorBasic))
+}
+
+func TestColor_downgrade(t *testing.T) {
+	// RGB to the 256 color cube
+	assert.Equal(t, "\x1b[38;5;208m", RGBColor(255, 135, 0).Sequence(Color256))
+	assert.Equal(t, "\x1b[38;5;196m", RGBColor(255, 0, 0).Sequence(Color256))
+	// RGB & 256 to the basic colors
+	assert.Equal(t, "\x1b[91m", RGBColor(255, 0, 0).Sequence(ColorBasic))
+	assert.Equal(t, "\x1b[31m", RGBColor(200, 0, 0).Sequence(ColorBasic))
+	assert.Equal(t, "\x1b[1;34m", PaletteColor(19).Bold().Sequence(ColorBasic))
+	assert.Equal(t, "\x1b[90m", PaletteColor(244).Sequence(ColorBasic))
+	assert.Equal(t, "\x1b[32m", PaletteColor(2).Sequence(ColorBasic))
+}
+
+func TestFormatter_Color(t *testing.T) {
+	logEvent := event.New(0, event.Critical, "msg", nil, false)
+	formatter := EventFormatter(logEvent)
+	assert.Equal(t, "\x1b[1;31mfoo\x1b[0m", formatter.Color("foo"))
+	assert.Equal(t, "\x1b[1;31mkey\x1b[0m", formatter.KeyColor("key"))
+	assert.Equal(t, "value", formatter.ValueColor("value"))
+
+	logEvent.Level = event.Debug
+	assert.Equal(t, "\x1b[90mfoo\x1b[0m", formatter.Color("foo"))
+
+	formatter.Theme = &Theme{
+		Levels: [8]Color{event.Debug: RGBColor(100, 100, 100)},
+		Key:    Blue,
+		Value:  LevelColor,
+	}
+	formatter.ColorLevel = ColorTrue
+	assert.Equal(t, "\x1b[38;2;100;100;100mfoo\x1b[0m", formatter.Color("foo"))
+	assert.Equal(t, "\x1b[34mkey\x1b[0m", formatter.KeyColor("key"))
+	assert.Equal(t, "\x1b[38;2;100;100;100mvalue\x1b[0m", formatter.ValueColor("value"))
+
+	formatter.ColorLevel = ColorNone
+	assert.Equal(t, "foo", formatter.Color("foo"))
+	assert.Equal(t, "key", formatter.KeyColor("key"))
+}
@@ -0,0 +1,131 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// Encoder converts an event into the bytes to write out, as an alternative to a template.
+// The encoding is appended to buf, without a trailing newline.
+type Encoder interface {
+	Encode(buf *bytes.Buffer, logEvent *event.Event) error
+}
+
+// TimeFormatUnix may be used as JSONOptions.TimeFormat to encode the time as the number of seconds since the epoch, with 9 decimal places for the nanoseconds (e.g. `1451703845.000000006`).
+const TimeFormatUnix = "unix"
+
+// JSONOptions controls the output of a JSONEncoder.
+// The zero value results in `{"ts":"...","level":"info","msg":"...",<fields>}`.
+type JSONOptions struct {
+	// TimeKey, LevelKey, and MessageKey are the keys of the event's time, level name, and message.
+	// They default to "ts", "level", and "msg".
+	TimeKey, LevelKey, MessageKey string
+
+	// TimeFormat is the format given to time.Format(), or TimeFormatUnix. Defaults to time.RFC3339Nano.
+	TimeFormat string
+
+	// FieldsKey is the key under which the event's fields are placed. If empty, the fields are placed in the top level object alongside the time, level & message, which take precedence over any fields of the same name.
+	FieldsKey string
+
+	// FlatFields uses the event's flattened fields (`"foo.bar": 1`), instead of the nested fields (`"foo": {"bar": 1}`).
+	FlatFields bool
+
+	// Stack includes the event's stack trace, if it has one, under StackKey (default "stack").
+	Stack    bool
+	StackKey string
+
+	// Caller includes the event's caller, as `file.go:42`, if it has one, under CallerKey (default "caller").
+	Caller    bool
+	CallerKey string
+}
+
+// JSONEncoder is an Encoder which converts each event into a single line JSON object.
+type JSONEncoder struct {
+	options JSONOptions
+}
+
+// NewJSONEncoder constructs a JSONEncoder with the given options.
+func NewJSONEncoder(options JSONOptions) *JSONEncoder {
+	defaultString(&options.TimeKey, "ts")
+	defaultString(&options.LevelKey, "level")
+	defaultString(&options.MessageKey, "msg")
+	defaultString(&options.TimeFormat, time.RFC3339Nano)
+	defaultString(&options.StackKey, "stack")
+	defaultString(&options.CallerKey, "caller")
+	return &JSONEncoder{options: options}
+}
+
+func defaultString(s *string, value string) {
+	if *s == "" {
+		*s = value
+	}
+}
+
+// Encode fills the Encoder interface.
+func (encoder *JSONEncoder) Encode(buf *bytes.Buffer, logEvent *event.Event) error {
+	options := encoder.options
+
+	var fields interface{}
+	if options.FlatFields {
+		fields = event.JSONValue(logEvent.FlatFields)
+	} else {
+		fields = event.JSONValue(logEvent.Fields)
+	}
+
+	obj, isMap := fields.(map[string]interface{})
+	if options.FieldsKey != "" || !isMap {
+		fieldsKey := options.FieldsKey
+		if fieldsKey == "" {
+			// the fields aren't an object, so can't be merged into the top level
+			fieldsKey = "fields"
+		}
+		obj = map[string]interface{}{}
+		if fields != nil {
+			obj[fieldsKey] = fields
+		}
+	}
+
+	if options.TimeFormat == TimeFormatUnix {
+		obj[options.TimeKey] = json.Number(formatUnix(logEvent.Time))
+	} else {
+		obj[options.TimeKey] = logEvent.Time.Format(options.TimeFormat)
+	}
+	obj[options.LevelKey] = logEvent.Level.String()
+	obj[options.MessageKey] = logEvent.Message
+	if options.Stack && len(logEvent.Stack) > 0 {
+		obj[options.StackKey] = logEvent.Stack
+	}
+	if options.Caller && logEvent.Caller != nil {
+		obj[options.CallerKey] = path.Base(logEvent.Caller.File) + ":" + strconv.Itoa(logEvent.Caller.Line)
+	}
+
+	jsonEncoder := json.NewEncoder(buf)
+	jsonEncoder.SetEscapeHTML(false)
+	if err := jsonEncoder.Encode(obj); err != nil {
+		return err
+	}
+	// json.Encoder adds a newline, which is left to the caller
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// formatUnix formats the time as seconds since the epoch with nanosecond decimals.
+// Integers are used throughout, as a float64 cannot hold the nanoseconds of a current time.
+func formatUnix(t time.Time) string {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	sign := ""
+	if sec < 0 && nsec > 0 {
+		// Unix() rounds down, so e.g. -1.5s is -2 + 0.5s
+		sec, nsec = sec+1, int64(time.Second)-nsec
+		if sec == 0 {
+			sign = "-"
+		}
+	}
+	return fmt.Sprintf("%s%d.%09d", sign, sec, nsec)
+}
@@ -4,48 +4,25 @@ package formatter
 import (
 	"fmt"
 	"github.com/phemmer/sawmill/event"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
 )
 
-type ansiColorCodes struct {
-	Bold, Normal, Black, BlackBold, Red, RedBold, Green, GreenBold, Yellow, YellowBold, Blue, BlueBold, Magenta, MagentaBold, Cyan, CyanBold, White, WhiteBold, Underline, Reset []byte
-}
-
-var colors = ansiColorCodes{
-	Bold:        []byte{27, '[', '1', 'm'},
-	Normal:      []byte{27, '[', '2', '2', 'm'},
-	Black:       []byte{27, '[', '3', '0', 'm'},
-	BlackBold:   []byte{27, '[', '3', '0', ';', '1', 'm'},
-	Red:         []byte{27, '[', '3', '1', 'm'},
-	RedBold:     []byte{27, '[', '3', '1', ';', '1', 'm'},
-	Green:       []byte{27, '[', '3', '2', 'm'},
-	GreenBold:   []byte{27, '[', '3', '2', ';', '1', 'm'},
-	Yellow:      []byte{27, '[', '3', '3', 'm'},
-	YellowBold:  []byte{27, '[', '3', '3', ';', '1', 'm'},
-	Blue:        []byte{27, '[', '3', '4', 'm'},
-	BlueBold:    []byte{27, '[', '3', '4', ';', '1', 'm'},
-	Magenta:     []byte{27, '[', '3', '5', 'm'},
-	MagentaBold: []byte{27, '[', '3', '5', ';', '1', 'm'},
-	Cyan:        []byte{27, '[', '3', '6', 'm'},
-	CyanBold:    []byte{27, '[', '3', '6', ';', '1', 'm'},
-	White:       []byte{27, '[', '3', '7', 'm'},
-	WhiteBold:   []byte{27, '[', '3', '7', ';', '1', 'm'},
-
-	Underline: []byte{27, '[', '4', 'm'},
-
-	Reset: []byte{27, '[', '0', 'm'},
-}
-
 const (
-	SIMPLE_FORMAT          = "{{.Message}} --{{range $k,$v := .Fields}} {{$k}}={{$.Quote $v}}{{end}}"
-	CONSOLE_COLOR_FORMAT   = "{{.Time \"2006-01-02_15:04:05.000\"}} {{.Level | .Color | printf \"%s>\" | .Pad -10}} {{.Message | .Pad -30}}{{range $k,$v := .Fields}} {{$k | $.Color}}={{$.Quote $v}}{{end}}"
-	CONSOLE_NOCOLOR_FORMAT = "{{.Time \"2006-01-02_15:04:05.000\"}} {{.Level | printf \"%s>\" | .Pad -10}} {{.Message | .Pad -30}}{{range $k,$v := .Fields}} {{$k}}={{$.Quote $v}}{{end}}"
+	SIMPLE_FORMAT          = "{{.Message}} --{{range .OrderedFields}} {{.Key}}={{$.Quote .Value}}{{end}}"
+	CONSOLE_COLOR_FORMAT   = "{{.Time \"2006-01-02_15:04:05.000\"}} {{.Level | .Color | printf \"%s>\" | .Pad -10}} {{.Message | .Pad -30}}{{range .OrderedFields}} {{.Key | $.KeyColor}}={{$.Quote .Value | $.ValueColor}}{{end}}"
+	CONSOLE_NOCOLOR_FORMAT = "{{.Time \"2006-01-02_15:04:05.000\"}} {{.Level | printf \"%s>\" | .Pad -10}} {{.Message | .Pad -30}}{{range .OrderedFields}} {{.Key}}={{$.Quote .Value}}{{end}}"
 )
 
 type Formatter struct { // TODO(.) it feels really weird not having the formatter contain the format.
 	Event *event.Event
+	// Theme is the colors used by Color, KeyColor & ValueColor. If nil, DefaultTheme is used.
+	Theme *Theme
+	// ColorLevel is the color support of the output. Colors the output doesn't support are converted to the nearest one which is, and ColorNone disables color entirely.
+	ColorLevel ColorLevel
 }
 
 // EventFormatter constructs a new Formatter containing the given event.
@@ -65,21 +42,42 @@ func (formatter *Formatter) Level() string {
 }
 
 // Color wraps the given text in ANSI color escapes appropriate to the event's level.
-// Error and higher are red. Warning is yellow. Notice and lower are cyan.
+// The colors come from the formatter's Theme. By default, debug is gray, info & notice are cyan, warning is yellow, error is red, and critical and higher are bold red.
 func (formatter *Formatter) Color(text string) string {
-	var levelColor []byte
-	if formatter.Event.Level >= event.Error {
-		levelColor = colors.Red
-	} else if formatter.Event.Level == event.Warning {
-		levelColor = colors.Yellow
-	} else {
-		levelColor = colors.Cyan
+	theme := formatter.theme()
+	return colorize(theme.levelColor(formatter.Event.Level), formatter.ColorLevel, text)
+}
+
+// KeyColor wraps the given text in the theme's color for field keys.
+func (formatter *Formatter) KeyColor(text string) string {
+	return formatter.themeColor(formatter.theme().Key, text)
+}
+
+// ValueColor wraps the given text in the theme's color for field values.
+func (formatter *Formatter) ValueColor(text string) string {
+	return formatter.themeColor(formatter.theme().Value, text)
+}
+
+func (formatter *Formatter) theme() *Theme {
+	if formatter.Theme == nil {
+		return DefaultTheme
 	}
-	return fmt.Sprintf("%s%s%s", levelColor, text, colors.Reset)
+	return formatter.Theme
+}
+
+func (formatter *Formatter) themeColor(color Color, text string) string {
+	if color == LevelColor {
+		return formatter.Color(text)
+	}
+	return colorize(color, formatter.ColorLevel, text)
 }
 
 // ToString converts any arbitrary data into a string.
 func (formatter *Formatter) ToString(data interface{}) string {
+	return toString(data)
+}
+
+func toString(data interface{}) string {
 	if str, ok := data.(string); ok {
 		return str
 	}
@@ -158,3 +156,62 @@ func (formatter *Formatter) Message() string {
 func (formatter *Formatter) Fields() map[string]interface{} {
 	return formatter.Event.FlatFields
 }
+
+// Field is a single key & value returned by OrderedFields.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// OrderedFields returns the same fields as Fields, but as a list in the order the fields were provided to the event. See event.Event.FieldOrder.
+// Unlike ranging over Fields, which text/template does in alphabetical order, this keeps output reading the way it was written. For example:
+//  {{range .OrderedFields}} {{.Key}}={{$.Quote .Value}}{{end}}
+//
+// Any fields missing from the event's FieldOrder are placed at the end in alphabetical order.
+func (formatter *Formatter) OrderedFields() []Field {
+	flatFields := formatter.Event.FlatFields
+	fields := make([]Field, 0, len(flatFields))
+	seen := make(map[string]bool, len(flatFields))
+	for _, key := range formatter.Event.FieldOrder {
+		value, ok := flatFields[key]
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		fields = append(fields, Field{Key: key, Value: value})
+	}
+
+	if len(fields) < len(flatFields) {
+		var remaining []string
+		for key := range flatFields {
+			if !seen[key] {
+				remaining = append(remaining, key)
+			}
+		}
+		sort.Strings(remaining)
+		for _, key := range remaining {
+			fields = append(fields, Field{Key: key, Value: flatFields[key]})
+		}
+	}
+
+	return fields
+}
+
+// Caller returns the source location which generated the event, as `/path/to/file.go:42`.
+// An empty string is returned if the event has no caller information. See Logger.SetCallerInfo().
+func (formatter *Formatter) Caller() string {
+	caller := formatter.Event.Caller
+	if caller == nil {
+		return ""
+	}
+	return caller.File + ":" + strconv.Itoa(caller.Line)
+}
+
+// ShortCaller is the same as Caller, but with only the base name of the file, such as `file.go:42`.
+func (formatter *Formatter) ShortCaller() string {
+	caller := formatter.Event.Caller
+	if caller == nil {
+		return ""
+	}
+	return path.Base(caller.File) + ":" + strconv.Itoa(caller.Line)
+}
@@ -0,0 +1,198 @@
+package formatter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// The names of the standard sub-templates defined in every template created by Template().
+// A handler's template can include one with `{{template "simple" .}}`.
+const (
+	SimpleTemplate         = "simple"
+	ConsoleColorTemplate   = "console_color"
+	ConsoleNocolorTemplate = "console_nocolor"
+)
+
+var funcMap = template.FuncMap{
+	"json":     jsonFunc,
+	"truncate": truncateFunc,
+	"upper":    func(s interface{}) string { return strings.ToUpper(toString(s)) },
+	"lower":    func(s interface{}) string { return strings.ToLower(toString(s)) },
+	"default":  defaultFunc,
+	"field":    fieldFunc,
+	"stack":    stackFunc,
+	"caller":   callerFunc,
+	"hostname": hostnameFunc,
+	"pid":      os.Getpid,
+	"env":      os.Getenv,
+	"since":    time.Since,
+	"indent":   indentFunc,
+}
+var funcMapMutex sync.RWMutex
+
+// FuncMap returns a copy of the functions available to templates created by Template():
+//  json VALUE             - VALUE encoded as JSON.
+//  truncate LENGTH VALUE  - VALUE cut to at most LENGTH characters.
+//  upper VALUE            - VALUE in upper case.
+//  lower VALUE            - VALUE in lower case.
+//  default DEFAULT VALUE  - VALUE, or DEFAULT if VALUE is empty.
+//  field KEY FORMATTER    - The flat field KEY (e.g. "a.b") of the event, or nil. Typically `{{field "a.b" .}}`.
+//  stack FORMATTER        - The event's stack trace, one `function\n\tfile:line` entry per frame.
+//  caller FORMATTER       - The event's caller as `file:line`. See Formatter.Caller().
+//  hostname               - The system hostname.
+//  pid                    - The process ID.
+//  env NAME               - The value of the environment variable NAME.
+//  since TIME             - The time.Duration elapsed since TIME, e.g. `{{since .Event.Time}}`.
+//  indent SPACES VALUE    - VALUE with each line prefixed by SPACES spaces.
+//
+// Functions which take a FORMATTER also accept an *event.Event.
+func FuncMap() template.FuncMap {
+	funcMapMutex.RLock()
+	defer funcMapMutex.RUnlock()
+	funcs := make(template.FuncMap, len(funcMap))
+	for name, fn := range funcMap {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// RegisterFunc adds a function to those available in templates created by Template() after the call.
+// The function must meet the requirements of text/template.FuncMap.
+func RegisterFunc(name string, fn interface{}) {
+	funcMapMutex.Lock()
+	funcMap[name] = fn
+	funcMapMutex.Unlock()
+}
+
+// Template creates an empty template with the FuncMap() functions, and the standard sub-templates (SimpleTemplate, ConsoleColorTemplate & ConsoleNocolorTemplate) defined.
+// Handlers may add their own functions with Funcs() before parsing their template text.
+func Template(name string) *template.Template {
+	tmpl := template.New(name).Funcs(FuncMap())
+	template.Must(tmpl.New(SimpleTemplate).Parse(SIMPLE_FORMAT))
+	template.Must(tmpl.New(ConsoleColorTemplate).Parse(CONSOLE_COLOR_FORMAT))
+	template.Must(tmpl.New(ConsoleNocolorTemplate).Parse(CONSOLE_NOCOLOR_FORMAT))
+	return tmpl
+}
+
+// NewTemplate creates a template with Template(), and parses the given text into it.
+func NewTemplate(name string, text string) (*template.Template, error) {
+	return Template(name).Parse(text)
+}
+
+func jsonFunc(value interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(event.JSONValue(value)); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func truncateFunc(length int, value interface{}) string {
+	s := toString(value)
+	if utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	i := 0
+	for pos := range s {
+		if i == length {
+			return s[:pos]
+		}
+		i++
+	}
+	return s
+}
+
+func defaultFunc(def interface{}, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+	if s, ok := value.(string); ok && s == "" {
+		return def
+	}
+	return value
+}
+
+// formatterEvent returns the event of a *Formatter or *event.Event.
+func formatterEvent(data interface{}) (*event.Event, error) {
+	switch data := data.(type) {
+	case *Formatter:
+		return data.Event, nil
+	case *event.Event:
+		return data, nil
+	}
+	return nil, fmt.Errorf("expected formatter or event, got %T", data)
+}
+
+func fieldFunc(key string, data interface{}) (interface{}, error) {
+	logEvent, err := formatterEvent(data)
+	if err != nil {
+		return nil, err
+	}
+	return logEvent.FlatFields[key], nil
+}
+
+func stackFunc(data interface{}) (string, error) {
+	logEvent, err := formatterEvent(data)
+	if err != nil {
+		return "", err
+	}
+	return EventFormatter(logEvent).Stack(), nil
+}
+
+func callerFunc(data interface{}) (string, error) {
+	logEvent, err := formatterEvent(data)
+	if err != nil {
+		return "", err
+	}
+	return EventFormatter(logEvent).Caller(), nil
+}
+
+var hostname string
+var hostnameOnce sync.Once
+
+func hostnameFunc() string {
+	hostnameOnce.Do(func() { hostname, _ = os.Hostname() })
+	return hostname
+}
+
+func indentFunc(spaces int, value interface{}) string {
+	prefix := strings.Repeat(" ", spaces)
+	return prefix + strings.Replace(toString(value), "\n", "\n"+prefix, -1)
+}
+
+// Field returns the flat field with the given key (e.g. "a.b"), or nil if the event has no such field.
+func (formatter *Formatter) Field(key string) interface{} {
+	return formatter.Event.FlatFields[key]
+}
+
+// Stack returns the event's stack trace, with one `function\n\tfile:line` entry per frame, in the same style as a Go panic.
+// An empty string is returned if the event has no stack trace.
+func (formatter *Formatter) Stack() string {
+	var buf bytes.Buffer
+	for _, frame := range formatter.Event.Stack {
+		if frame == nil {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(frame.Function)
+		buf.WriteString("\n\t")
+		buf.WriteString(frame.File)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.Itoa(frame.Line))
+	}
+	return buf.String()
+}
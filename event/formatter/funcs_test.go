@@ -0,0 +1,75 @@
+package formatter
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+func execute(t *testing.T, text string, logEvent *event.Event) string {
+	tmpl, err := NewTemplate("test", text)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, tmpl.Execute(&buf, EventFormatter(logEvent)))
+	return buf.String()
+}
+
+func TestFuncMap(t *testing.T) {
+	logEvent := event.New(1, event.Info, "héllo world", map[string]interface{}{
+		"a":     map[string]interface{}{"b": "nested"},
+		"empty": "",
+		"lines": "one\ntwo",
+	}, false)
+	logEvent.Stack = []*event.StackFrame{
+		{Function: "main.foo", File: "/src/main.go", Line: 12},
+		{Function: "main.main", File: "/src/main.go", Line: 3},
+	}
+	logEvent.Caller = logEvent.Stack[0]
+	hostname, _ := os.Hostname()
+	os.Setenv("SAWMILL_TEST_ENV", "envvalue")
+	defer os.Unsetenv("SAWMILL_TEST_ENV")
+
+	tests := map[string]string{
+		`{{json .Event.Fields}}`:                           `{"a":{"b":"nested"},"empty":"","lines":"one\ntwo"}`,
+		`{{.Message | truncate 2}}`:                        `hé`,
+		`{{.Message | truncate 50}}`:                       `héllo world`,
+		`{{.Message | upper}}`:                             `HÉLLO WORLD`,
+		`{{field "empty" . | default "-"}}`:                `-`,
+		`{{field "missing" . | default "-"}}`:              `-`,
+		`{{field "a.b" . | default "-"}}`:                  `nested`,
+		`{{.Field "a.b"}}`:                                 `nested`,
+		`{{stack .}}`:                                      "main.foo\n\t/src/main.go:12\nmain.main\n\t/src/main.go:3",
+		`{{caller .Event}}`:                                `/src/main.go:12`,
+		`{{hostname}}`:                                     hostname,
+		`{{pid}}`:                                          strconv.Itoa(os.Getpid()),
+		`{{env "SAWMILL_TEST_ENV"}}`:                       `envvalue`,
+		`{{indent 2 (field "lines" .)}}`:                   "  one\n  two",
+		`{{if lt (since .Event.Time).Hours 1.0}}ok{{end}}`: `ok`,
+	}
+	for text, expected := range tests {
+		assert.Equal(t, expected, execute(t, text, logEvent), text)
+	}
+}
+
+func TestTemplate_subTemplate(t *testing.T) {
+	logEvent := event.New(1, event.Info, "testing", map[string]interface{}{"foo": "bar baz"}, false)
+	assert.Equal(t, `prefix: testing -- foo="bar baz"`, execute(t, `prefix: {{template "simple" .}}`, logEvent))
+}
+
+func TestRegisterFunc(t *testing.T) {
+	RegisterFunc("double", func(s string) string { return s + s })
+	defer func() {
+		funcMapMutex.Lock()
+		delete(funcMap, "double")
+		funcMapMutex.Unlock()
+	}()
+
+	logEvent := event.New(1, event.Info, "ab", nil, false)
+	assert.Equal(t, "abab", execute(t, `{{double .Message}}`, logEvent))
+}
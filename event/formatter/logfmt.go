@@ -0,0 +1,241 @@
+package formatter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// LogfmtEncoder is an Encoder which converts each event into a logfmt line:
+//  time=2016-01-02T03:04:05.000000006Z level=info msg="something happened" foo.bar=baz
+// The time, level, and message are followed by the event's flat fields, sorted by key.
+// As with the JSON encoder, fields with the same key as the time, level, or message are omitted.
+//
+// Keys are stripped of characters logfmt does not permit in them (spaces, `=`, `"`, and control characters). Values are quoted when they contain any of those characters, or are not valid UTF-8.
+type LogfmtEncoder struct {
+	// TimeKey, LevelKey, and MessageKey are the keys of the event's time, level name, and message.
+	// They default to "time", "level", and "msg".
+	TimeKey, LevelKey, MessageKey string
+
+	// TimeFormat is the format given to time.Format(). Defaults to time.RFC3339Nano.
+	TimeFormat string
+}
+
+// NewLogfmtEncoder constructs a LogfmtEncoder with the default keys & time format.
+func NewLogfmtEncoder() *LogfmtEncoder {
+	return &LogfmtEncoder{
+		TimeKey:    "time",
+		LevelKey:   "level",
+		MessageKey: "msg",
+		TimeFormat: time.RFC3339Nano,
+	}
+}
+
+// Encode fills the Encoder interface.
+func (encoder *LogfmtEncoder) Encode(buf *bytes.Buffer, logEvent *event.Event) error {
+	timeKey, levelKey, messageKey, timeFormat := encoder.TimeKey, encoder.LevelKey, encoder.MessageKey, encoder.TimeFormat
+	defaultString(&timeKey, "time")
+	defaultString(&levelKey, "level")
+	defaultString(&messageKey, "msg")
+	defaultString(&timeFormat, time.RFC3339Nano)
+
+	writeLogfmtPair(buf, timeKey, logEvent.Time.Format(timeFormat))
+	buf.WriteByte(' ')
+	writeLogfmtPair(buf, levelKey, logEvent.Level.String())
+	buf.WriteByte(' ')
+	writeLogfmtPair(buf, messageKey, logEvent.Message)
+
+	keys := make([]string, 0, len(logEvent.FlatFields))
+	for k := range logEvent.FlatFields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == timeKey || k == levelKey || k == messageKey {
+			continue
+		}
+		buf.WriteByte(' ')
+		writeLogfmtPair(buf, k, logfmtString(logEvent.FlatFields[k]))
+	}
+	return nil
+}
+
+// logfmtString converts a field value into the string to place in the logfmt output.
+func logfmtString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func writeLogfmtPair(buf *bytes.Buffer, key string, value string) {
+	writeLogfmtKey(buf, key)
+	buf.WriteByte('=')
+	writeLogfmtValue(buf, value)
+}
+
+func invalidLogfmtKeyRune(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == 0x7f || r == utf8.RuneError
+}
+
+func writeLogfmtKey(buf *bytes.Buffer, key string) {
+	start := buf.Len()
+	for _, r := range key {
+		if invalidLogfmtKeyRune(r) {
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	if buf.Len() == start {
+		// a key is mandatory
+		buf.WriteByte('_')
+	}
+}
+
+func needLogfmtQuote(value string) bool {
+	for _, r := range value {
+		if invalidLogfmtKeyRune(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeLogfmtValue(buf *bytes.Buffer, value string) {
+	if !needLogfmtQuote(value) {
+		buf.WriteString(value)
+		return
+	}
+
+	buf.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < ' ' || r == 0x7f {
+				fmt.Fprintf(buf, `\u%04x`, r)
+				continue
+			}
+			// invalid UTF-8 is written as the replacement character
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// LogfmtField is a single key/value pair parsed by ParseLogfmt.
+type LogfmtField struct {
+	Key   string
+	Value string
+}
+
+// ParseLogfmt parses a single logfmt line into its key/value pairs, in the order they appear.
+// A key with no `=` has an empty value.
+func ParseLogfmt(line []byte) ([]LogfmtField, error) {
+	var fields []LogfmtField
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t' || line[i] == '\n' || line[i] == '\r') {
+			i++
+		}
+		if i == len(line) {
+			return fields, nil
+		}
+
+		start := i
+		for i < len(line) && line[i] > ' ' && line[i] != '=' && line[i] != '"' {
+			i++
+		}
+		if i == start {
+			return nil, fmt.Errorf("unexpected %q at position %d", line[i], i)
+		}
+		field := LogfmtField{Key: string(line[start:i])}
+
+		if i < len(line) && line[i] == '=' {
+			i++
+			if i < len(line) && line[i] == '"' {
+				start = i
+				for i++; i < len(line) && line[i] != '"'; i++ {
+					if line[i] == '\\' {
+						i++
+					}
+				}
+				if i >= len(line) {
+					return nil, fmt.Errorf("unterminated quoted value for key %q", field.Key)
+				}
+				i++
+				value, err := strconv.Unquote(string(line[start:i]))
+				if err != nil {
+					return nil, fmt.Errorf("invalid quoted value for key %q: %s", field.Key, err)
+				}
+				field.Value = value
+			} else {
+				start = i
+				for i < len(line) && line[i] > ' ' && line[i] != '"' {
+					i++
+				}
+				field.Value = string(line[start:i])
+			}
+		}
+		if i < len(line) && line[i] > ' ' {
+			return nil, fmt.Errorf("unexpected %q at position %d", line[i], i)
+		}
+
+		fields = append(fields, field)
+	}
+}
+
+// ParseLogfmtEvent parses a line generated by a LogfmtEncoder with the default keys & time format back into an event.
+// The event's fields are strings, as logfmt does not preserve types. Fields are placed in both Fields and FlatFields.
+func ParseLogfmtEvent(line []byte) (*event.Event, error) {
+	fields, err := ParseLogfmt(line)
+	if err != nil {
+		return nil, err
+	}
+
+	logEvent := &event.Event{FlatFields: map[string]interface{}{}}
+	eventFields := map[string]interface{}{}
+	for _, field := range fields {
+		switch field.Key {
+		case "time":
+			if logEvent.Time, err = time.Parse(time.RFC3339Nano, field.Value); err != nil {
+				return nil, err
+			}
+		case "level":
+			if logEvent.Level, err = event.ParseLevel(field.Value); err != nil {
+				return nil, err
+			}
+		case "msg":
+			logEvent.Message = field.Value
+		default:
+			logEvent.FlatFields[field.Key] = field.Value
+			eventFields[field.Key] = field.Value
+		}
+	}
+	logEvent.Fields = eventFields
+	return logEvent, nil
+}
@@ -0,0 +1,82 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+func TestLogfmtEncoder(t *testing.T) {
+	e := event.New(0, event.Warning, "something happened", map[string]interface{}{
+		"b":          "plain",
+		"a":          "has space",
+		"quote":      `say "hi"`,
+		"newline":    "foo\nbar",
+		"empty":      "",
+		"bad key=\"": 1,
+		"err":        errors.New("boom"),
+		"backslash":  `C:\foo`,
+		"ctrl":       "\x01",
+		"invalid":    "\xff",
+		"unicode":    "héllo",
+	}, false)
+	e.Time = time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, NewLogfmtEncoder().Encode(buf, e))
+	assert.Equal(t, `time=2016-01-02T03:04:05.000000006Z level=warning msg="something happened"`+
+		` a="has space" b=plain backslash=C:\foo badkey=1 ctrl="\u0001" empty= err=boom err.type=*errors.errorString invalid="`+"\ufffd"+`" newline="foo\nbar" quote="say \"hi\"" unicode=héllo`,
+		buf.String())
+}
+
+func TestParseLogfmt(t *testing.T) {
+	fields, err := ParseLogfmt([]byte(`a=1 b="two words" c= d e="esc\"aped\n\u0001" f=C:\foo`))
+	require.NoError(t, err)
+	assert.Equal(t, []LogfmtField{
+		{"a", "1"},
+		{"b", "two words"},
+		{"c", ""},
+		{"d", ""},
+		{"e", "esc\"aped\n\x01"},
+		{"f", `C:\foo`},
+	}, fields)
+
+	for _, line := range []string{`=foo`, `a="unterminated`, `a="bad\escape"`, `a=b"c`, `a="b"c`} {
+		_, err := ParseLogfmt([]byte(line))
+		assert.Error(t, err, line)
+	}
+}
+
+func TestParseLogfmtEvent(t *testing.T) {
+	e := event.New(0, event.Error, "round trip", map[string]interface{}{"foo": map[string]interface{}{"bar": "baz qux"}, "n": 3}, false)
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, NewLogfmtEncoder().Encode(buf, e))
+
+	parsed, err := ParseLogfmtEvent(buf.Bytes())
+	require.NoError(t, err)
+	assert.True(t, e.Time.Equal(parsed.Time))
+	assert.Equal(t, event.Error, parsed.Level)
+	assert.Equal(t, "round trip", parsed.Message)
+	assert.Equal(t, map[string]interface{}{"foo.bar": "baz qux", "n": "3"}, parsed.FlatFields)
+}
+
+func TestParseLogfmtEvent_headerKeys(t *testing.T) {
+	e := event.New(0, event.Error, "round trip", map[string]interface{}{"time": "x", "level": "debug", "msg": "other", "n": 3}, false)
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, NewLogfmtEncoder().Encode(buf, e))
+
+	parsed, err := ParseLogfmtEvent(buf.Bytes())
+	require.NoError(t, err)
+	assert.True(t, e.Time.Equal(parsed.Time))
+	assert.Equal(t, event.Error, parsed.Level)
+	assert.Equal(t, "round trip", parsed.Message)
+	assert.Equal(t, map[string]interface{}{"n": "3"}, parsed.FlatFields)
+}
@@ -0,0 +1,219 @@
+package formatter
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// PrettyEncoder is an Encoder meant for reading events on a console during development.
+// Unlike the single line console formats, each field is placed on its own line, with nested fields shown as an indented tree, and multi-line values shown line by line:
+//  15:04:05.000 ERROR  request failed
+//      method = GET
+//      request
+//        path   = /foo
+//        status = 500
+//      body   = |
+//        first line
+//        second line
+//      stack:
+//        main.handle
+//          /src/main.go:42
+//            41 |   resp, err := process(req)
+//          > 42 |   if err != nil {
+//            43 |     sawmill.Error("request failed", ...)
+//
+// Control characters, including terminal escape sequences, are escaped in keys & values so that they cannot corrupt the terminal.
+type PrettyEncoder struct {
+	// TimeFormat is the format given to time.Format().
+	TimeFormat string
+	// Theme and ColorLevel control the colors. See Formatter.
+	Theme      *Theme
+	ColorLevel ColorLevel
+	// StackMinLevel is the minimum level at which the event's stack trace is shown, if it has one.
+	StackMinLevel event.Level
+	// SourceLines is the number of source code lines to show before and after each stack frame. Negative disables showing source code.
+	SourceLines int
+}
+
+// NewPrettyEncoder constructs a PrettyEncoder with the default settings: time of day with milliseconds, no color, and stack traces with 2 lines of source context for events of error level and higher.
+func NewPrettyEncoder() *PrettyEncoder {
+	return &PrettyEncoder{
+		TimeFormat:    "15:04:05.000",
+		ColorLevel:    ColorNone,
+		StackMinLevel: event.Error,
+		SourceLines:   2,
+	}
+}
+
+const prettyIndent = "    "
+
+func noColor(text string) string { return text }
+
+// Encode fills the Encoder interface.
+func (encoder *PrettyEncoder) Encode(buf *bytes.Buffer, logEvent *event.Event) error {
+	formatter := &Formatter{Event: logEvent, Theme: encoder.Theme, ColorLevel: encoder.ColorLevel}
+
+	buf.WriteString(formatter.Time(encoder.TimeFormat))
+	buf.WriteByte(' ')
+	buf.WriteString(formatter.Pad(-6, formatter.Color(strings.ToUpper(logEvent.Level.String()))))
+	buf.WriteByte(' ')
+	writePrettyLines(buf, logEvent.Message, prettyIndent, noColor)
+
+	root := prettyTree(logEvent)
+	encoder.writeNodes(buf, formatter, root.children, prettyIndent)
+
+	if logEvent.Level.Standard() >= encoder.StackMinLevel && len(logEvent.Stack) > 0 {
+		buf.WriteByte('\n')
+		buf.WriteString(prettyIndent)
+		buf.WriteString(formatter.KeyColor("stack:"))
+		encoder.writeStack(buf, logEvent.Stack, prettyIndent+"  ")
+	}
+
+	return nil
+}
+
+// prettyNode is a field in the tree of fields. A node may have both a value and children, such as an error with its type.
+type prettyNode struct {
+	key      string
+	value    interface{}
+	hasValue bool
+	children []*prettyNode
+	index    map[string]*prettyNode
+}
+
+func (node *prettyNode) child(key string) *prettyNode {
+	if child, ok := node.index[key]; ok {
+		return child
+	}
+	child := &prettyNode{key: key}
+	if node.index == nil {
+		node.index = map[string]*prettyNode{}
+	}
+	node.index[key] = child
+	node.children = append(node.children, child)
+	return child
+}
+
+// prettyTree rebuilds the nested fields from the event's flat fields, keeping the order of the fields.
+func prettyTree(logEvent *event.Event) *prettyNode {
+	root := &prettyNode{}
+	for _, field := range (&Formatter{Event: logEvent}).OrderedFields() {
+		node := root
+		for _, key := range strings.Split(field.Key, ".") {
+			node = node.child(key)
+		}
+		node.value = field.Value
+		node.hasValue = true
+	}
+	return root
+}
+
+func (encoder *PrettyEncoder) writeNodes(buf *bytes.Buffer, formatter *Formatter, nodes []*prettyNode, indent string) {
+	keyWidth := 0
+	for _, node := range nodes {
+		if width := utf8.RuneCountInString(prettySafe(node.key)); node.hasValue && width > keyWidth {
+			keyWidth = width
+		}
+	}
+
+	for _, node := range nodes {
+		buf.WriteByte('\n')
+		buf.WriteString(indent)
+		key := prettySafe(node.key)
+		buf.WriteString(formatter.KeyColor(key))
+		if node.hasValue {
+			buf.WriteString(strings.Repeat(" ", keyWidth-utf8.RuneCountInString(key)))
+			buf.WriteString(" = ")
+			value := toString(node.value)
+			if strings.Contains(value, "\n") {
+				buf.WriteString("|\n")
+				buf.WriteString(indent + "  ")
+				writePrettyLines(buf, value, indent+"  ", formatter.ValueColor)
+			} else {
+				buf.WriteString(formatter.ValueColor(prettySafe(value)))
+			}
+		}
+		encoder.writeNodes(buf, formatter, node.children, indent+"  ")
+	}
+}
+
+// writePrettyLines writes a possibly multi-line string, with the lines after the first indented.
+// Each line is escaped with prettySafe() and then passed through color, so that colors do not span the indentation.
+func writePrettyLines(buf *bytes.Buffer, text string, indent string, color func(string) string) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteByte('\n')
+			buf.WriteString(indent)
+		}
+		buf.WriteString(color(prettySafe(strings.TrimSuffix(line, "\r"))))
+	}
+}
+
+// prettySafe escapes control characters other than tab, including the escape character, so that text cannot move the cursor, change colors, or otherwise manipulate the terminal.
+func prettySafe(text string) string {
+	var buf *bytes.Buffer
+	for i, r := range text {
+		if (r >= ' ' || r == '\t') && r != 0x7f {
+			if buf != nil {
+				buf.WriteRune(r)
+			}
+			continue
+		}
+		if buf == nil {
+			buf = bytes.NewBufferString(text[:i])
+		}
+		quoted := strconv.QuoteRune(r)
+		buf.WriteString(quoted[1 : len(quoted)-1])
+	}
+	if buf == nil {
+		return text
+	}
+	return buf.String()
+}
+
+func (encoder *PrettyEncoder) writeStack(buf *bytes.Buffer, stack []*event.StackFrame, indent string) {
+	for _, frame := range stack {
+		if frame == nil {
+			continue
+		}
+		buf.WriteByte('\n')
+		buf.WriteString(indent)
+		buf.WriteString(frame.Function)
+		buf.WriteByte('\n')
+		buf.WriteString(indent + "  ")
+		buf.WriteString(frame.File)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.Itoa(frame.Line))
+
+		if encoder.SourceLines < 0 {
+			continue
+		}
+		linesBefore, line, linesAfter := frame.SourceContext(encoder.SourceLines, encoder.SourceLines)
+		if line == nil {
+			continue
+		}
+		lineNum := frame.Line - len(linesBefore)
+		width := len(strconv.Itoa(frame.Line + len(linesAfter)))
+		writeSource := func(marker string, source []byte) {
+			buf.WriteByte('\n')
+			buf.WriteString(indent + "  " + marker + " ")
+			num := strconv.Itoa(lineNum)
+			buf.WriteString(strings.Repeat(" ", width-len(num)) + num)
+			buf.WriteString(" | ")
+			buf.WriteString(prettySafe(string(source)))
+			lineNum++
+		}
+		for _, source := range linesBefore {
+			writeSource(" ", source)
+		}
+		writeSource(">", line)
+		for _, source := range linesAfter {
+			writeSource(" ", source)
+		}
+	}
+}
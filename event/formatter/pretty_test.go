@@ -0,0 +1,90 @@
+package formatter
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+func TestPrettyEncoder(t *testing.T) {
+	e := event.NewWithFields(0, event.Warning, "request failed", []event.Field{
+		{Key: "method", Value: "GET"},
+		{Key: "request", Value: map[string]interface{}{
+			"path":   "/foo",
+			"status": 500,
+		}},
+		{Key: "body", Value: "first line\nsecond line\n"},
+		{Key: "err", Value: errors.New("boom")},
+		{Key: "evil", Value: "\x1b[2Jcleared"},
+	}, false)
+	e.Time = time.Date(2016, 1, 2, 3, 4, 5, 6000000, time.UTC)
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, NewPrettyEncoder().Encode(buf, e))
+	assert.Equal(t, strings.Join([]string{
+		"03:04:05.006 WARNING request failed",
+		"    method = GET",
+		"    request",
+		"      path   = /foo",
+		"      status = 500",
+		"    body   = |",
+		"      first line",
+		"      second line",
+		"    err    = boom",
+		"      type = *errors.errorString",
+		`    evil   = \x1b[2Jcleared`,
+	}, "\n"), buf.String())
+}
+
+func TestPrettyEncoder_color(t *testing.T) {
+	e := event.New(0, event.Info, "msg", map[string]interface{}{"foo": "a\nb"}, false)
+
+	encoder := NewPrettyEncoder()
+	encoder.ColorLevel = ColorBasic
+	encoder.Theme = &Theme{Levels: [8]Color{event.Info: Green}, Value: Blue}
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, encoder.Encode(buf, e))
+	assert.Contains(t, buf.String(), " \x1b[32mINFO\x1b[0m   msg")
+	// each line of a multi-line value is colored separately
+	assert.Contains(t, buf.String(), "foo = |\n      \x1b[34ma\x1b[0m\n      \x1b[34mb\x1b[0m")
+}
+
+func TestPrettyEncoder_stack(t *testing.T) {
+	source, err := ioutil.TempFile("", "sawmill-pretty")
+	require.NoError(t, err)
+	defer os.Remove(source.Name())
+	_, err = source.WriteString("line 1\nline 2\nline 3\nline 4\n")
+	require.NoError(t, err)
+	source.Close()
+
+	encoder := NewPrettyEncoder()
+	encoder.SourceLines = 1
+	e := event.New(0, event.Error, "msg", nil, false)
+	e.Stack = []*event.StackFrame{{Function: "main.foo", File: source.Name(), Line: 2}}
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, encoder.Encode(buf, e))
+	assert.Equal(t, strings.Join([]string{
+		"    stack:",
+		"      main.foo",
+		"        " + source.Name() + ":2",
+		"          1 | line 1",
+		"        > 2 | line 2",
+		"          3 | line 3",
+	}, "\n"), buf.String()[strings.Index(buf.String(), "\n")+1:])
+
+	// below StackMinLevel, the stack is not shown
+	e.Level = event.Warning
+	buf.Reset()
+	require.NoError(t, encoder.Encode(buf, e))
+	assert.NotContains(t, buf.String(), "stack:")
+}
@@ -0,0 +1,150 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// jsonEvent is the JSON schema of an Event.
+type jsonEvent struct {
+	Id         uint64                 `json:"id"`
+	Time       time.Time              `json:"time"`
+	Level      Level                  `json:"level"`
+	Message    string                 `json:"message"`
+	Fields     interface{}            `json:"fields,omitempty"`
+	FlatFields map[string]interface{} `json:"flat_fields,omitempty"`
+	FieldOrder []string               `json:"field_order,omitempty"`
+	Stack      []*StackFrame          `json:"stack,omitempty"`
+	Caller     *StackFrame            `json:"caller,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+//
+// The event is encoded as an object with the keys `id`, `time` (RFC3339 with nanoseconds), `level` (the level name), `message`, `fields`, `flat_fields`, `field_order`, `stack` & `caller`. The last five are omitted when empty.
+// Field values which JSON cannot represent, such as maps with non-string keys, are converted to an equivalent which it can (see UnmarshalJSON).
+func (e *Event) MarshalJSON() ([]byte, error) {
+	je := jsonEvent{
+		Id:         e.Id,
+		Time:       e.Time,
+		Level:      e.Level,
+		Message:    e.Message,
+		Fields:     JSONValue(e.Fields),
+		FieldOrder: e.FieldOrder,
+		Stack:      e.Stack,
+		Caller:     e.Caller,
+	}
+	if len(e.FlatFields) > 0 {
+		je.FlatFields = make(map[string]interface{}, len(e.FlatFields))
+		for k, v := range e.FlatFields {
+			je.FlatFields[k] = JSONValue(v)
+		}
+	}
+	return json.Marshal(je)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding an event encoded by MarshalJSON.
+//
+// The decoded event is equivalent to the original, with the same limitations as any JSON decoding: maps become map[string]interface{}, slices become []interface{}, and numbers become json.Number (so that integers are not turned into floats).
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var je jsonEvent
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&je); err != nil {
+		return err
+	}
+
+	e.Id = je.Id
+	e.Time = je.Time
+	e.Level = je.Level
+	e.Message = je.Message
+	e.Fields = je.Fields
+	e.FlatFields = je.FlatFields
+	e.FieldOrder = je.FieldOrder
+	if e.FlatFields == nil {
+		e.FlatFields = map[string]interface{}{}
+	}
+	e.Stack = je.Stack
+	e.Caller = je.Caller
+	return nil
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+var errorInterfaceType = reflect.TypeOf((*error)(nil)).Elem()
+
+// JSONValue converts a field value into something encoding/json is able to encode. Maps with non-string keys have their keys converted to strings, errors are converted to their message, and values JSON has no representation for, such as NaN & functions, are converted to strings.
+//
+// This is meant for handlers which encode events as JSON in a schema of their own.
+func JSONValue(value interface{}) interface{} {
+	return jsonValue(reflect.ValueOf(value))
+}
+
+func jsonValue(value reflect.Value) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+
+	if value.Kind() == reflect.Interface || value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		if value.Kind() == reflect.Interface {
+			return jsonValue(value.Elem())
+		}
+	}
+
+	if value.CanInterface() {
+		if value.Type().Implements(jsonMarshalerType) {
+			return value.Interface()
+		}
+		if value.Type().Implements(errorInterfaceType) {
+			return value.Interface().(error).Error()
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.Ptr:
+		return jsonValue(value.Elem())
+	case reflect.Map:
+		m := make(map[string]interface{}, value.Len())
+		for _, key := range value.MapKeys() {
+			m[fmt.Sprintf("%v", key.Interface())] = jsonValue(value.MapIndex(key))
+		}
+		return m
+	case reflect.Slice:
+		if value.IsNil() {
+			return nil
+		}
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return value.Bytes()
+		}
+		fallthrough
+	case reflect.Array:
+		s := make([]interface{}, value.Len())
+		for i := range s {
+			s[i] = jsonValue(value.Index(i))
+		}
+		return s
+	case reflect.Struct:
+		if !value.CanInterface() {
+			return fmt.Sprintf("%v", value)
+		}
+		return value.Interface()
+	case reflect.Float32, reflect.Float64:
+		f := value.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Sprintf("%v", f)
+		}
+		return f
+	case reflect.Complex64, reflect.Complex128, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Sprintf("%v", value)
+	}
+
+	if !value.CanInterface() {
+		return fmt.Sprintf("%v", value)
+	}
+	return value.Interface()
+}
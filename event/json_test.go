@@ -0,0 +1,102 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvent_MarshalJSON(t *testing.T) {
+	e := New(12, Warning, "testing", map[string]interface{}{"foo": map[string]interface{}{"bar": "baz"}, "n": 3}, false)
+	e.Time = time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	data, err := json.Marshal(e)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id": 12,
+		"time": "2016-01-02T03:04:05.000000006Z",
+		"level": "warning",
+		"message": "testing",
+		"fields": {"foo": {"bar": "baz"}, "n": 3},
+		"flat_fields": {"foo.bar": "baz", "n": 3},
+		"field_order": ["foo.bar", "n"]
+	}`, string(data))
+}
+
+func TestEvent_MarshalJSON_unencodable(t *testing.T) {
+	e := New(1, Info, "testing", map[interface{}]interface{}{
+		1:     "int key",
+		"err": errors.New("boom"),
+		"nan": math.NaN(),
+	}, false)
+
+	data, err := json.Marshal(e)
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	fields := decoded["fields"].(map[string]interface{})
+	assert.Equal(t, "int key", fields["1"])
+	assert.Equal(t, "NaN", fields["nan"])
+
+	// values which deStruct passes through untouched
+	assert.Equal(t, []byte("hi"), jsonValue(reflect.ValueOf([]byte("hi"))))
+	assert.Equal(t, "(1+2i)", jsonValue(reflect.ValueOf(complex(1, 2))))
+	assert.IsType(t, "", jsonValue(reflect.ValueOf(func() {})))
+}
+
+func TestEvent_UnmarshalJSON(t *testing.T) {
+	e := New(12, Error, "testing", map[string]interface{}{"foo": map[string]interface{}{"bar": "baz"}, "list": []int{1, 2}, "n": 3}, true)
+	e.Caller = e.Stack[0]
+
+	data, err := json.Marshal(e)
+	require.NoError(t, err)
+
+	var decoded Event
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	assert.Equal(t, e.Id, decoded.Id)
+	assert.True(t, e.Time.Equal(decoded.Time))
+	assert.Equal(t, e.Level, decoded.Level)
+	assert.Equal(t, e.Message, decoded.Message)
+	assert.Equal(t, map[string]interface{}{
+		"foo":  map[string]interface{}{"bar": "baz"},
+		"list": []interface{}{json.Number("1"), json.Number("2")},
+		"n":    json.Number("3"),
+	}, decoded.Fields)
+	assert.Equal(t, map[string]interface{}{
+		"foo.bar": "baz",
+		"list.0":  json.Number("1"),
+		"list.1":  json.Number("2"),
+		"n":       json.Number("3"),
+	}, decoded.FlatFields)
+	assert.Equal(t, e.FieldOrder, decoded.FieldOrder)
+	require.Len(t, decoded.Stack, len(e.Stack))
+	for i := range e.Stack {
+		assert.Equal(t, *e.Stack[i], *decoded.Stack[i])
+	}
+	require.NotNil(t, decoded.Caller)
+	assert.Equal(t, *e.Caller, *decoded.Caller)
+
+	// re-encoding must produce the same document
+	data2, err := json.Marshal(&decoded)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(data), string(data2))
+}
+
+func TestEvent_UnmarshalJSON_customLevel(t *testing.T) {
+	e := New(1, Level(42), "testing", nil, false)
+	data, err := json.Marshal(e)
+	require.NoError(t, err)
+
+	var decoded Event
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, Level(42), decoded.Level)
+	assert.NotNil(t, decoded.FlatFields)
+}
@@ -0,0 +1,52 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Lazy is a field value which is computed by calling the function when the event is generated.
+//
+// When used with a sawmill.Logger, events which no handler will accept are never generated, and so the function is never called. This makes it suitable for expensive values such as debug dumps.
+// The function is called on the goroutine generating the event, and its result is copied the same as any other field value.
+type Lazy func() interface{}
+
+// SawmillValue calls the function and returns its result. This satisfies the Valuer interface.
+func (lazy Lazy) SawmillValue() interface{} {
+	return lazy()
+}
+
+// Deferred is a field value which is computed only when a handler needs it, such as when formatting the event.
+// The function is called at most once, and the result is shared by all handlers.
+//
+// Unlike Lazy, the function is called from a handler's goroutine, and the result is not copied. Thus the function must be safe to call concurrently with the code which generated the event.
+// Also unlike Lazy, the value is not flattened into nested fields. It is treated as a single scalar value.
+type Deferred struct {
+	valueFunc func() interface{}
+	once      sync.Once
+	value     interface{}
+}
+
+// NewDeferred constructs a Deferred which obtains its value from valueFunc.
+func NewDeferred(valueFunc func() interface{}) *Deferred {
+	return &Deferred{valueFunc: valueFunc}
+}
+
+// Value returns the value, calling the function if it has not already been called.
+func (deferred *Deferred) Value() interface{} {
+	deferred.once.Do(func() {
+		deferred.value = deferred.valueFunc()
+	})
+	return deferred.value
+}
+
+// String returns the value formatted with fmt's `%v`.
+func (deferred *Deferred) String() string {
+	return fmt.Sprintf("%v", deferred.Value())
+}
+
+// MarshalJSON encodes the value as JSON.
+func (deferred *Deferred) MarshalJSON() ([]byte, error) {
+	return json.Marshal(deferred.Value())
+}
@@ -0,0 +1,41 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazy(t *testing.T) {
+	calls := 0
+	lazy := Lazy(func() interface{} {
+		calls++
+		return map[string]interface{}{"foo": "bar"}
+	})
+
+	logEvent := New(1, Info, "test", map[string]interface{}{"lazy": lazy}, false)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "bar", logEvent.FlatFields["lazy.foo"])
+}
+
+func TestDeferred(t *testing.T) {
+	calls := 0
+	deferred := NewDeferred(func() interface{} {
+		calls++
+		return 123
+	})
+
+	logEvent := New(1, Info, "test", map[string]interface{}{"deferred": deferred}, false)
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, deferred, logEvent.FlatFields["deferred"])
+
+	assert.Equal(t, "123", fmt.Sprintf("%v", logEvent.FlatFields["deferred"]))
+	assert.Equal(t, 1, calls)
+
+	data, err := json.Marshal(logEvent.FlatFields)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"deferred":123}`, string(data))
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,192 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Level int
+
+const (
+	Debug, Dbg Level = iota, iota
+	Info, _
+	Notice, _
+	Warning, Warn
+	Error, Err
+	Critical, Crit
+	Alert, Alrt
+	Emergency, Emerg
+)
+
+var levelNames = [8]string{
+	"debug",
+	"info",
+	"notice",
+	"warning",
+	"error",
+	"critical",
+	"alert",
+	"emergency",
+}
+
+// levelAliases are the additional names accepted by ParseLevel for the standard levels.
+var levelAliases = map[string]Level{
+	"dbg":   Dbg,
+	"warn":  Warn,
+	"err":   Err,
+	"crit":  Crit,
+	"alrt":  Alrt,
+	"emerg": Emerg,
+}
+
+type customLevel struct {
+	name     string
+	standard Level
+}
+
+var customLevels = map[Level]customLevel{}
+var customLevelsMutex sync.RWMutex
+
+// RegisterLevel adds a named level in addition to the standard ones, such as `trace` below Debug, or `audit` above Emergency.
+// The standard level is what the event is treated as by handlers which only understand the standard levels, such as syslog & sentry. See Level.Standard().
+//
+// For example:
+//  const Trace = event.Level(-1)
+//  event.RegisterLevel(Trace, "trace", event.Debug)
+//
+// An error is returned if the level is one of the standard levels, or if the name is already in use by a different level.
+func RegisterLevel(level Level, name string, standard Level) error {
+	if level.isStandard() {
+		return fmt.Errorf("cannot register standard level %s", level)
+	}
+	if !standard.isStandard() {
+		return fmt.Errorf("level %d is not a standard level", standard)
+	}
+	name = strings.ToLower(name)
+
+	customLevelsMutex.Lock()
+	defer customLevelsMutex.Unlock()
+	if existing, err := parseLevelName(name); err == nil && existing != level {
+		return fmt.Errorf("level name %q is already in use", name)
+	}
+	customLevels[level] = customLevel{name: name, standard: standard}
+	return nil
+}
+
+// ParseLevel converts a level name into a Level. Names are case insensitive, and include aliases such as `warn` & `crit`, as well as registered levels (see RegisterLevel()).
+// The integer value of a level is also accepted, either on its own or in the `level(N)` form returned by String() for unnamed levels.
+func ParseLevel(name string) (Level, error) {
+	customLevelsMutex.RLock()
+	defer customLevelsMutex.RUnlock()
+	return parseLevelName(strings.ToLower(name))
+}
+
+// parseLevelName is ParseLevel for a lower case name, with customLevelsMutex held.
+func parseLevelName(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if name == levelName {
+			return Level(i), nil
+		}
+	}
+	if level, ok := levelAliases[name]; ok {
+		return level, nil
+	}
+	for level, custom := range customLevels {
+		if name == custom.name {
+			return level, nil
+		}
+	}
+	if i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "level("), ")")); err == nil {
+		// either a plain integer, or the `level(N)` form returned by String()
+		return Level(i), nil
+	}
+	return 0, fmt.Errorf("unknown level %q", name)
+}
+
+func (l Level) isStandard() bool {
+	return l >= Debug && l <= Emergency
+}
+
+// String returns the name of the level.
+// Unnamed levels are returned as `level(N)`.
+func (l Level) String() string {
+	if l.isStandard() {
+		return levelNames[l]
+	}
+
+	customLevelsMutex.RLock()
+	custom, ok := customLevels[l]
+	customLevelsMutex.RUnlock()
+	if ok {
+		return custom.name
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+func (l Level) Int() int {
+	return int(l)
+}
+
+// Standard returns the standard level (Debug through Emergency) which the level corresponds to.
+// Registered levels return the standard level they were registered with. Other levels are clamped to the nearest standard level.
+func (l Level) Standard() Level {
+	if l.isStandard() {
+		return l
+	}
+
+	customLevelsMutex.RLock()
+	custom, ok := customLevels[l]
+	customLevelsMutex.RUnlock()
+	if ok {
+		return custom.standard
+	}
+	if l < Debug {
+		return Debug
+	}
+	return Emergency
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting anything ParseLevel() does.
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The level is encoded as its name.
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Both level names and integers are accepted.
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var i int
+	if err := json.Unmarshal(data, &i); err == nil {
+		*l = Level(i)
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	return l.UnmarshalText([]byte(name))
+}
+
+// Set implements flag.Value, so that a level can be used as a command line flag:
+//  level := event.Info
+//  flag.Var(&level, "level", "minimum log level")
+func (l *Level) Set(name string) error {
+	return l.UnmarshalText([]byte(name))
+}
@@ -0,0 +1,114 @@
+package event
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]Level{
+		"debug":     Debug,
+		"INFO":      Info,
+		"Warning":   Warning,
+		"warn":      Warning,
+		"err":       Error,
+		"crit":      Critical,
+		"alrt":      Alert,
+		"emerg":     Emergency,
+		"emergency": Emergency,
+		"3":         Warning,
+		"-1":        Level(-1),
+		"level(20)": Level(20),
+	}
+	for name, expected := range tests {
+		level, err := ParseLevel(name)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, expected, level, name)
+		}
+	}
+
+	_, err := ParseLevel("bogus")
+	assert.Error(t, err)
+}
+
+func TestRegisterLevel(t *testing.T) {
+	trace := Level(-1)
+	audit := Level(100)
+	require.NoError(t, RegisterLevel(trace, "Trace", Debug))
+	require.NoError(t, RegisterLevel(audit, "audit", Notice))
+	defer func() {
+		customLevelsMutex.Lock()
+		delete(customLevels, trace)
+		delete(customLevels, audit)
+		customLevelsMutex.Unlock()
+	}()
+
+	assert.Equal(t, "trace", trace.String())
+	assert.Equal(t, Debug, trace.Standard())
+	assert.Equal(t, "audit", audit.String())
+	assert.Equal(t, Notice, audit.Standard())
+
+	level, err := ParseLevel("TRACE")
+	assert.NoError(t, err)
+	assert.Equal(t, trace, level)
+
+	// re-registering the same level is allowed
+	assert.NoError(t, RegisterLevel(trace, "trace", Debug))
+
+	assert.Error(t, RegisterLevel(Warning, "warn2", Warning))
+	assert.Error(t, RegisterLevel(Level(101), "audit", Notice))
+	assert.Error(t, RegisterLevel(Level(101), "warn", Notice))
+	assert.Error(t, RegisterLevel(Level(101), "audit2", Level(50)))
+}
+
+func TestLevel_unregistered(t *testing.T) {
+	assert.Equal(t, "level(-5)", Level(-5).String())
+	assert.Equal(t, Debug, Level(-5).Standard())
+	assert.Equal(t, "level(20)", Level(20).String())
+	assert.Equal(t, Emergency, Level(20).Standard())
+	assert.Equal(t, Error, Error.Standard())
+}
+
+func TestLevel_text(t *testing.T) {
+	text, err := Warning.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "warning", string(text))
+
+	var level Level
+	assert.NoError(t, level.UnmarshalText([]byte("crit")))
+	assert.Equal(t, Critical, level)
+	assert.Error(t, level.UnmarshalText([]byte("bogus")))
+}
+
+func TestLevel_json(t *testing.T) {
+	type config struct {
+		Level Level
+	}
+
+	data, err := json.Marshal(config{Level: Notice})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Level":"notice"}`, string(data))
+
+	var c config
+	require.NoError(t, json.Unmarshal([]byte(`{"Level":"err"}`), &c))
+	assert.Equal(t, Error, c.Level)
+	require.NoError(t, json.Unmarshal([]byte(`{"Level":6}`), &c))
+	assert.Equal(t, Alert, c.Level)
+	assert.Error(t, json.Unmarshal([]byte(`{"Level":"bogus"}`), &c))
+}
+
+func TestLevel_flag(t *testing.T) {
+	level := Info
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.SetOutput(ioutil.Discard)
+	flagSet.Var(&level, "level", "")
+
+	require.NoError(t, flagSet.Parse([]string{"-level", "warn"}))
+	assert.Equal(t, Warning, level)
+	assert.Error(t, flagSet.Parse([]string{"-level", "bogus"}))
+}
@@ -0,0 +1,74 @@
+package event
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var eventPool = sync.Pool{
+	New: func() interface{} { return &Event{} },
+}
+
+// Acquire is the equivalent of New(), but obtains the Event object from a pool instead of allocating a new one.
+// The flat field map and field order of a recycled event are reused.
+//
+// The returned event has a reference count of 1. Once the caller is done with the event, it must call Release(), after which the event must not be used.
+// Anything which needs to hold on to the event past that point must first call Retain().
+func Acquire(id uint64, level Level, message string, fields interface{}, getStack bool) *Event {
+	logEvent := acquire()
+	newEvent(logEvent, id, level, message, fields, getStack)
+	logEvent.refs = 1
+	logEvent.pooled = true
+	return logEvent
+}
+
+// AcquireWithFields is the equivalent of NewWithFields(), but obtains the Event object from a pool instead of allocating a new one.
+// The flat field map and field order of a recycled event are reused.
+//
+// See Acquire() for the rules on using the returned event.
+func AcquireWithFields(id uint64, level Level, message string, fields []Field, getStack bool) *Event {
+	logEvent := acquire()
+	newWithFields(logEvent, id, level, message, fields, getStack)
+	logEvent.refs = 1
+	logEvent.pooled = true
+	return logEvent
+}
+
+func acquire() *Event {
+	return eventPool.Get().(*Event)
+}
+
+// Retain increments the reference count of the event, preventing it from being recycled until a matching call to Release().
+//
+// Handlers which hold on to an event after their Event() method returns must call Retain(). A handler which never calls Release() is safe, the event is simply left for the garbage collector.
+//
+// Retain has no effect on events which did not come from Acquire() or AcquireWithFields().
+func (e *Event) Retain() {
+	if !e.pooled {
+		return
+	}
+	atomic.AddInt32(&e.refs, 1)
+}
+
+// Release decrements the reference count of the event. When the count reaches zero, the event is reset and returned to the pool.
+//
+// Release has no effect on events which did not come from Acquire() or AcquireWithFields().
+func (e *Event) Release() {
+	if !e.pooled {
+		return
+	}
+	refs := atomic.AddInt32(&e.refs, -1)
+	if refs > 0 {
+		return
+	}
+	if refs < 0 {
+		panic("sawmill: event released more times than retained")
+	}
+
+	flatFields := e.FlatFields
+	for k := range flatFields {
+		delete(flatFields, k)
+	}
+	*e = Event{FlatFields: flatFields, FieldOrder: e.FieldOrder[:0]}
+	eventPool.Put(e)
+}
@@ -0,0 +1,53 @@
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquire(t *testing.T) {
+	logEvent := Acquire(1, Info, "testing", map[string]interface{}{"foo": "bar"}, false)
+	assert.Equal(t, uint64(1), logEvent.Id)
+	assert.Equal(t, "testing", logEvent.Message)
+	assert.Equal(t, "bar", logEvent.FlatFields["foo"])
+	assert.True(t, logEvent.pooled)
+	assert.Equal(t, int32(1), logEvent.refs)
+
+	logEvent.Retain()
+	logEvent.Release()
+	// still referenced, so must not have been reset
+	assert.Equal(t, "testing", logEvent.Message)
+
+	logEvent.Release()
+	assert.Equal(t, "", logEvent.Message)
+	assert.Empty(t, logEvent.FlatFields)
+}
+
+func TestAcquireWithFields(t *testing.T) {
+	logEvent := AcquireWithFields(1, Info, "testing", []Field{{"foo", "bar"}, {"n", 3}}, false)
+	assert.Equal(t, "bar", logEvent.FlatFields["foo"])
+	assert.Equal(t, 3, logEvent.FlatFields["n"])
+	logEvent.Release()
+
+	logEvent = AcquireWithFields(2, Info, "again", []Field{{"baz", true}}, false)
+	assert.Equal(t, map[string]interface{}{"baz": true}, logEvent.FlatFields)
+	logEvent.Release()
+}
+
+func TestEvent_releaseUnpooled(t *testing.T) {
+	logEvent := New(1, Info, "testing", nil, false)
+	logEvent.Retain()
+	logEvent.Release()
+	logEvent.Release()
+	// unpooled events are never reset
+	assert.Equal(t, "testing", logEvent.Message)
+}
+
+func TestNewStackFrame_cache(t *testing.T) {
+	stack := captureStack()
+	require.NotEmpty(t, stack)
+	frame := newStackFrame(stack[0].PC)
+	assert.True(t, frame == stack[0])
+}
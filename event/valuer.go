@@ -0,0 +1,93 @@
+package event
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Valuer is implemented by types which control how they are copied into an event.
+// The returned value is used in place of the original, and is copied & flattened as any other field value would be.
+//
+// A common implementation is to return a string or a map of the type's relevant attributes.
+type Valuer interface {
+	SawmillValue() interface{}
+}
+
+// Fielder is implemented by types which provide their own set of fields to include in an event.
+// The returned map is used in place of the original value, and is copied & flattened as any other map would be.
+type Fielder interface {
+	LogFields() map[string]interface{}
+}
+
+// ValueFunc converts a value into the representation to use in an event.
+// It is the equivalent of Valuer for types which cannot implement the interface, such as those from other packages.
+type ValueFunc func(value interface{}) interface{}
+
+// valueFuncs holds a map[reflect.Type]ValueFunc. The map is never modified once stored, so reads need no lock. Registration stores a new copy.
+var valueFuncs atomic.Value
+
+// valueFuncsMutex serializes registrations.
+var valueFuncsMutex sync.Mutex
+
+// RegisterValueFunc registers a function to convert values of the same type as `sample` when they are copied into an event.
+// For example:
+//  event.RegisterValueFunc(uuid.UUID{}, func(v interface{}) interface{} { return v.(uuid.UUID).String() })
+//
+// Only values of the exact type are converted. Registering a type such as `T` does not affect `*T`.
+// Passing a nil valueFunc removes the registration.
+func RegisterValueFunc(sample interface{}, valueFunc ValueFunc) {
+	sampleType := reflect.TypeOf(sample)
+
+	valueFuncsMutex.Lock()
+	defer valueFuncsMutex.Unlock()
+	oldFuncs, _ := valueFuncs.Load().(map[reflect.Type]ValueFunc)
+	newFuncs := make(map[reflect.Type]ValueFunc, len(oldFuncs)+1)
+	for k, v := range oldFuncs {
+		newFuncs[k] = v
+	}
+	if valueFunc == nil {
+		delete(newFuncs, sampleType)
+	} else {
+		newFuncs[sampleType] = valueFunc
+	}
+	valueFuncs.Store(newFuncs)
+}
+
+func init() {
+	RegisterValueFunc(net.IP{}, func(v interface{}) interface{} { return v.(net.IP).String() })
+	RegisterValueFunc(url.URL{}, func(v interface{}) interface{} { u := v.(url.URL); return u.Redacted() })
+	RegisterValueFunc(&url.URL{}, func(v interface{}) interface{} { return v.(*url.URL).Redacted() })
+}
+
+// getValue checks whether the value implements Valuer or Fielder, or has a registered ValueFunc, and if so returns the converted value.
+func getValue(dataValue reflect.Value) (interface{}, bool) {
+	if !dataValue.IsValid() || !dataValue.CanInterface() {
+		return nil, false
+	}
+	switch dataValue.Kind() {
+	case reflect.Interface:
+		return nil, false
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if dataValue.IsNil() {
+			return nil, false
+		}
+	}
+
+	data := dataValue.Interface()
+	switch data := data.(type) {
+	case Valuer:
+		return data.SawmillValue(), true
+	case Fielder:
+		return data.LogFields(), true
+	}
+
+	funcs, _ := valueFuncs.Load().(map[reflect.Type]ValueFunc)
+	if valueFunc, ok := funcs[dataValue.Type()]; ok {
+		return valueFunc(data), true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,70 @@
+package sawmill
+
+import (
+	"time"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// The following functions construct typed fields. When every field passed to an event is a typed field, the event is generated without the reflection needed for Fields or structs. For example:
+//  logger.Info("request complete", sawmill.String("path", path), sawmill.Int("status", status), sawmill.Dur("duration", duration))
+
+// String constructs a field with a string value.
+func String(key string, value string) event.Field {
+	return event.Field{Key: key, Value: value}
+}
+
+// Int constructs a field with an int value.
+func Int(key string, value int) event.Field {
+	return event.Field{Key: key, Value: value}
+}
+
+// Int64 constructs a field with an int64 value.
+func Int64(key string, value int64) event.Field {
+	return event.Field{Key: key, Value: value}
+}
+
+// Float64 constructs a field with a float64 value.
+func Float64(key string, value float64) event.Field {
+	return event.Field{Key: key, Value: value}
+}
+
+// Bool constructs a field with a bool value.
+func Bool(key string, value bool) event.Field {
+	return event.Field{Key: key, Value: value}
+}
+
+// Dur constructs a field with a time.Duration value.
+func Dur(key string, value time.Duration) event.Field {
+	return event.Field{Key: key, Value: value}
+}
+
+// Time constructs a field with a time.Time value.
+func Time(key string, value time.Time) event.Field {
+	return event.Field{Key: key, Value: value}
+}
+
+// Err constructs a field with the key "error" and the given error.
+func Err(err error) event.Field {
+	return event.Field{Key: "error", Value: err}
+}
+
+// Any constructs a field with an arbitrary value. The value is copied the same as a value in Fields would be.
+func Any(key string, value interface{}) event.Field {
+	return event.Field{Key: key, Value: value}
+}
+
+// typedFields returns the fields as a slice of event.Field, if they are all typed fields.
+func typedFields(fields []interface{}) ([]event.Field, bool) {
+	if len(fields) == 0 {
+		return nil, false
+	}
+	typed := make([]event.Field, len(fields))
+	for i, field := range fields {
+		var ok bool
+		if typed[i], ok = field.(event.Field); !ok {
+			return nil, false
+		}
+	}
+	return typed, true
+}
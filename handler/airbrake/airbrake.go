@@ -165,9 +165,16 @@ func New(projectId int64, key string, environment string) *AirbrakeHandler {
 func (ah *AirbrakeHandler) Event(logEvent *event.Event) error {
 	errors := []*airbrakeError{}
 
+	// Use the type of the error the event was logged with, if any. Otherwise fall back to the level.
+	errType := logEvent.Level.String()
+	if t, ok := logEvent.FlatFields["error.type"].(string); ok {
+		errType = t
+	} else if t, ok := logEvent.FlatFields["err.type"].(string); ok {
+		errType = t
+	}
+
 	aErr := &airbrakeError{
-		//TODO once sawmill/event copies the original struct, we can access the type and expose it here
-		ErrType:   logEvent.Level.String(),
+		ErrType:   errType,
 		Message:   logEvent.Message,
 		Backtrace: newAirbrakeStack(logEvent.Stack),
 	}
@@ -70,3 +70,15 @@ func TestAirbrakeHandler(t *testing.T) {
 	nParams := notice["params"].(map[string]interface{})
 	assert.Equal(t, "bar", nParams["foo"])
 }
+
+func TestAirbrakeHandler_errorType(t *testing.T) {
+	ah := New(123456, "0123456789abcdef0123456789abcdef", "testing")
+
+	logEvent := event.New(1, event.Error, "test AirbrakeHandler", map[string]interface{}{"error": &os.PathError{Op: "open", Path: "/foo", Err: os.ErrNotExist}}, true)
+	err := ah.Event(logEvent)
+	require.NoError(t, err)
+
+	notice := testAirbrakeServer.notices[len(testAirbrakeServer.notices)-1]
+	nError := notice["errors"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "*fs.PathError", nError["type"])
+}
@@ -27,6 +27,8 @@ func NewHandler() *Handler {
 
 // Event fills the sawmill.Handler interface
 func (handler *Handler) Event(logEvent *event.Event) error {
+	// captured events are handed out to callers, so they must never be recycled
+	logEvent.Retain()
 	handler.mutex.Lock()
 	handler.events = append(handler.events, logEvent)
 	handler.mutex.Unlock()
@@ -26,6 +26,8 @@ func NewHandler() *Handler {
 
 // Event fills the sawmill.Handler interface for logging events
 func (handler *Handler) Event(logEvent *event.Event) error {
+	// the reader takes ownership of the event, so it must never be recycled
+	logEvent.Retain()
 	handler.channel <- logEvent
 	return nil
 }
@@ -0,0 +1,517 @@
+/*
+The file package is an event handler which writes to a file, rotating it by size, by time interval, or on demand.
+
+Rotation renames the active file and opens a new one in its place, so unlike logrotate's copytruncate, no lines are lost.
+Rotated files can be gzip compressed, and removed once there are too many of them or they get too old. Both happen in the background.
+
+Example:
+
+ logger := sawmill.NewLogger()
+ h, err := file.New("/var/log/foo.log", 0600, "", file.Options{
+ 	MaxSize:    100 * 1024 * 1024,
+ 	Interval:   24 * time.Hour,
+ 	MaxBackups: 7,
+ 	Compress:   true,
+ })
+ if err != nil {
+ 	sawmill.Panic("error opening log file", sawmill.Fields{"error": err, "path": "/var/log/foo.log"})
+ }
+ logger.AddHandler("logfile", h)
+
+ logger.Info("FOO!", sawmill.Fields{"bar": "baz"})
+
+With the default naming pattern, rotated files are named like /var/log/foo-20160102T030405.log.gz.
+*/
+package file
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phemmer/sawmill/event"
+	"github.com/phemmer/sawmill/event/formatter"
+	"github.com/phemmer/sawmill/handler/writer"
+)
+
+// DefaultNamePattern is the NamePattern used when Options.NamePattern is empty.
+const DefaultNamePattern = "{name}-{time}{ext}"
+
+// DefaultTimeFormat is the TimeFormat used when Options.TimeFormat is empty.
+const DefaultTimeFormat = "20060102T150405"
+
+// statInterval is how often the handler checks that the path still refers to the open file.
+const statInterval = time.Second
+
+// ErrClosed is returned when writing to a handler after Close().
+var ErrClosed = errors.New("file handler closed")
+
+// Options controls when and how the file is rotated.
+// The zero value never rotates, except on demand with Rotate().
+type Options struct {
+	// MaxSize is the size in bytes after which the file is rotated. 0 disables rotation by size.
+	// The file is rotated before a write which would take it past MaxSize, so a file only exceeds MaxSize if a single event is larger.
+	MaxSize int64
+
+	// Interval is how often the file is rotated, e.g. time.Hour or 24*time.Hour. 0 disables rotation by time.
+	// Rotations are aligned to the interval, e.g. hourly rotation happens at the top of the hour. Intervals of whole days are aligned to local midnight.
+	Interval time.Duration
+
+	// NamePattern is the name given to rotated files, in the same directory as the active file.
+	// "{name}" is replaced by the active file's name without its extension, "{ext}" by the extension (including the dot), and "{time}" by the time the rotated file was started, formatted with TimeFormat.
+	// Defaults to DefaultNamePattern. The pattern must contain "{time}".
+	NamePattern string
+	// TimeFormat is the format given to time.Format() for "{time}". Defaults to DefaultTimeFormat.
+	TimeFormat string
+
+	// MaxBackups is the number of rotated files to keep. The oldest are removed first. 0 keeps all of them.
+	MaxBackups int
+	// MaxAge is how long rotated files are kept. 0 keeps them forever.
+	MaxAge time.Duration
+
+	// Compress gzips rotated files, adding ".gz" to their name.
+	Compress bool
+
+	// OnError is called with errors from the background compression & removal of rotated files.
+	// Defaults to printing the error on STDERR.
+	OnError func(error)
+}
+
+// Handler writes events to a file, rotating it according to its Options.
+// Handler is also an io.Writer, with the same rotation. Rotation only happens between writes, so an event is never split across files.
+type Handler struct {
+	path    string
+	mode    os.FileMode
+	options Options
+	writer  *writer.WriterHandler
+
+	mutex        sync.Mutex
+	file         *os.File
+	size         int64
+	started      time.Time
+	nextRotation time.Time
+	lastStat     time.Time
+	closed       bool
+
+	// background serializes the compression & removal of rotated files
+	background sync.Mutex
+	wg         sync.WaitGroup
+
+	now func() time.Time
+}
+
+// New constructs a Handler which writes to the file at the given path, creating it and its directory if necessary.
+// An existing file is appended to, and counts toward MaxSize & Interval from its last modification.
+// templateString must be a template supported by the sawmill/event/formatter package. If it is empty, formatter.SIMPLE_FORMAT is used.
+func New(path string, mode os.FileMode, templateString string, options Options) (*Handler, error) {
+	if options.NamePattern == "" {
+		options.NamePattern = DefaultNamePattern
+	}
+	if !strings.Contains(options.NamePattern, "{time}") {
+		return nil, fmt.Errorf("name pattern %q does not contain {time}", options.NamePattern)
+	}
+	if options.TimeFormat == "" {
+		options.TimeFormat = DefaultTimeFormat
+	}
+	if options.OnError == nil {
+		options.OnError = func(err error) { fmt.Fprintf(os.Stderr, "sawmill: %s\n", err) }
+	}
+
+	handler := &Handler{
+		path:    path,
+		mode:    mode,
+		options: options,
+		now:     time.Now,
+	}
+
+	var err error
+	if handler.writer, err = writer.New(handler, templateString); err != nil {
+		return nil, err
+	}
+
+	if err := handler.open(handler.now()); err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+// SetEncoder sets the encoder used to write events, in place of the template. For example:
+//  h.SetEncoder(formatter.NewJSONEncoder(formatter.JSONOptions{}))
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (handler *Handler) SetEncoder(encoder formatter.Encoder) *Handler {
+	handler.writer.Encoder = encoder
+	return handler
+}
+
+// Path returns the path of the active file.
+func (handler *Handler) Path() string {
+	return handler.path
+}
+
+// Event fills the sawmill.Handler interface.
+func (handler *Handler) Event(logEvent *event.Event) error {
+	return handler.writer.Event(logEvent)
+}
+
+// open opens the file at the handler's path, creating the directory if it has disappeared.
+// handler.mutex must be held, or the handler not yet shared.
+func (handler *Handler) open(now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(handler.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(handler.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, handler.mode)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	handler.file = file
+	handler.size = stat.Size()
+	handler.started = now
+	if handler.size > 0 && stat.ModTime().Before(now) {
+		handler.started = stat.ModTime()
+	}
+	handler.nextRotation = handler.rotationAfter(handler.started)
+	handler.lastStat = now
+	return nil
+}
+
+// rotationAfter returns the first rotation time after t, or the zero time if there is no rotation interval.
+func (handler *Handler) rotationAfter(t time.Time) time.Time {
+	interval := handler.options.Interval
+	if interval <= 0 {
+		return time.Time{}
+	}
+	if interval%(24*time.Hour) == 0 {
+		year, month, day := t.Date()
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location()).AddDate(0, 0, int(interval/(24*time.Hour)))
+	}
+	return t.Truncate(interval).Add(interval)
+}
+
+// Write fills the io.Writer interface. The file is rotated beforehand if needed.
+func (handler *Handler) Write(p []byte) (int, error) {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+
+	if handler.closed {
+		return 0, ErrClosed
+	}
+
+	now := handler.now()
+	if handler.file == nil || now.Sub(handler.lastStat) >= statInterval {
+		handler.checkFile(now)
+	}
+	if handler.file != nil && handler.needRotate(now, len(p)) {
+		if err := handler.rotate(now); err != nil {
+			handler.options.OnError(err)
+		}
+	}
+	if handler.file == nil {
+		if err := handler.open(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := handler.file.Write(p)
+	if err != nil {
+		// the file may have become unusable, e.g. its filesystem was unmounted. Try again once with a new file.
+		handler.file.Close()
+		handler.file = nil
+		if err := handler.open(now); err != nil {
+			return n, err
+		}
+		n, err = handler.file.Write(p)
+	}
+	handler.size += int64(n)
+	return n, err
+}
+
+// checkFile reopens the file if its path no longer refers to the open file, e.g. the file or its directory was removed.
+func (handler *Handler) checkFile(now time.Time) {
+	handler.lastStat = now
+	if handler.file == nil {
+		return
+	}
+	pathStat, err := os.Stat(handler.path)
+	if err == nil {
+		var fileStat os.FileInfo
+		if fileStat, err = handler.file.Stat(); err == nil && os.SameFile(pathStat, fileStat) {
+			return
+		}
+	}
+	handler.file.Close()
+	handler.file = nil
+}
+
+func (handler *Handler) needRotate(now time.Time, length int) bool {
+	if handler.options.MaxSize > 0 && handler.size > 0 && handler.size+int64(length) > handler.options.MaxSize {
+		return true
+	}
+	return !handler.nextRotation.IsZero() && !now.Before(handler.nextRotation)
+}
+
+// Rotate rotates the file immediately, regardless of size or time. Nothing is done if the file is empty.
+func (handler *Handler) Rotate() error {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+
+	if handler.closed {
+		return ErrClosed
+	}
+	now := handler.now()
+	handler.checkFile(now)
+	if handler.file == nil || handler.size == 0 {
+		return nil
+	}
+	return handler.rotate(now)
+}
+
+// rotate moves the active file to its rotated name, and opens a new one. handler.mutex must be held.
+func (handler *Handler) rotate(now time.Time) error {
+	handler.file.Close()
+	handler.file = nil
+
+	rotated := handler.rotatedName(handler.started)
+	if err := os.Rename(handler.path, rotated); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		// the file was removed from under us, there is nothing to keep
+		rotated = ""
+	}
+
+	err := handler.open(now)
+
+	handler.wg.Add(1)
+	go handler.afterRotate(rotated)
+
+	return err
+}
+
+// rotatedName returns the name for a file started at the given time, which is not already in use.
+func (handler *Handler) rotatedName(started time.Time) string {
+	dir, base := filepath.Split(handler.path)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	timeString := started.Format(handler.options.TimeFormat)
+
+	for i := 0; ; i++ {
+		suffix := timeString
+		if i > 0 {
+			suffix += "-" + strconv.Itoa(i)
+		}
+		rotated := filepath.Join(dir, strings.NewReplacer("{name}", name, "{ext}", ext, "{time}", suffix).Replace(handler.options.NamePattern))
+		if !exists(rotated) && !exists(rotated+".gz") {
+			return rotated
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// afterRotate compresses the rotated file, and removes old rotated files.
+func (handler *Handler) afterRotate(rotated string) {
+	defer handler.wg.Done()
+	handler.background.Lock()
+	defer handler.background.Unlock()
+
+	if rotated != "" && handler.options.Compress {
+		if err := compress(rotated); err != nil {
+			handler.options.OnError(fmt.Errorf("compressing %s: %s", rotated, err))
+		}
+	}
+
+	if err := handler.removeOld(); err != nil {
+		handler.options.OnError(err)
+	}
+}
+
+// compress gzips the file at path into path.gz, and removes the original.
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary name, so that a partial file is never mistaken for a rotated one
+	tmpPath := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, stat.Mode())
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	gz.Name = filepath.Base(path)
+	gz.ModTime = stat.ModTime()
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// keep the modification time, so that MaxAge applies to when the file was last written
+	os.Chtimes(path+".gz", stat.ModTime(), stat.ModTime())
+	return os.Remove(path)
+}
+
+// Backups returns the paths of the rotated files, newest first.
+// Only files whose name has a time in TimeFormat where NamePattern has "{time}" are included, so that files of the same name with other text there, such as "foo-access.log" next to "foo.log", are left alone.
+func (handler *Handler) Backups() ([]string, error) {
+	dir, base := filepath.Split(handler.path)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	glob := filepath.Join(dir, strings.NewReplacer(
+		"{name}", globEscape(name),
+		"{ext}", globEscape(ext),
+		"{time}", "*",
+	).Replace(handler.options.NamePattern))
+
+	// the glob's "*" matches anything, so the time is checked with a pattern which captures the text in place of each {time}
+	nameParts := strings.Split(strings.NewReplacer("{name}", name, "{ext}", ext).Replace(handler.options.NamePattern), "{time}")
+	for i, part := range nameParts {
+		nameParts[i] = regexp.QuoteMeta(part)
+	}
+	nameRegexp := regexp.MustCompile("^" + strings.Join(nameParts, "(.*?)") + `(?:\.gz)?$`)
+
+	// When the pattern ends in {time}, the first glob also matches the compressed files, so the matches are deduplicated.
+	var paths []string
+	seen := map[string]bool{}
+	for _, pattern := range []string{glob, glob + ".gz"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				paths = append(paths, match)
+			}
+		}
+	}
+
+	type backup struct {
+		path    string
+		modTime time.Time
+	}
+	backups := make([]backup, 0, len(paths))
+	for _, path := range paths {
+		if path == filepath.Clean(handler.path) || !handler.isRotatedName(nameRegexp, filepath.Base(path)) {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil || !stat.Mode().IsRegular() {
+			continue
+		}
+		backups = append(backups, backup{path, stat.ModTime()})
+	}
+	sort.SliceStable(backups, func(i, j int) bool { return backups[i].modTime.After(backups[j].modTime) })
+
+	paths = paths[:0]
+	for _, b := range backups {
+		paths = append(paths, b.path)
+	}
+	return paths, nil
+}
+
+// isRotatedName reports whether the text captured by nameRegexp in place of each {time} is a time in TimeFormat, optionally followed by the "-N" which rotatedName() adds to avoid a collision.
+func (handler *Handler) isRotatedName(nameRegexp *regexp.Regexp, base string) bool {
+	match := nameRegexp.FindStringSubmatch(base)
+	if match == nil {
+		return false
+	}
+	for _, timeString := range match[1:] {
+		if _, err := time.Parse(handler.options.TimeFormat, timeString); err == nil {
+			continue
+		}
+		i := strings.LastIndexByte(timeString, '-')
+		if i < 0 {
+			return false
+		}
+		if n, err := strconv.Atoi(timeString[i+1:]); err != nil || n < 1 {
+			return false
+		}
+		if _, err := time.Parse(handler.options.TimeFormat, timeString[:i]); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func globEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`).Replace(s)
+}
+
+// removeOld removes rotated files beyond MaxBackups, or older than MaxAge.
+func (handler *Handler) removeOld() error {
+	if handler.options.MaxBackups <= 0 && handler.options.MaxAge <= 0 {
+		return nil
+	}
+	backups, err := handler.Backups()
+	if err != nil {
+		return err
+	}
+
+	cutoff := handler.now().Add(-handler.options.MaxAge)
+	for i, path := range backups {
+		remove := handler.options.MaxBackups > 0 && i >= handler.options.MaxBackups
+		if !remove && handler.options.MaxAge > 0 {
+			if stat, err := os.Stat(path); err == nil && stat.ModTime().Before(cutoff) {
+				remove = true
+			}
+		}
+		if remove {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				handler.options.OnError(err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the file, and waits for any background compression & removal of rotated files to finish.
+// Events received after Close() are dropped.
+func (handler *Handler) Close() error {
+	handler.mutex.Lock()
+	var err error
+	if !handler.closed {
+		handler.closed = true
+		if handler.file != nil {
+			err = handler.file.Close()
+			handler.file = nil
+		}
+	}
+	handler.mutex.Unlock()
+
+	handler.wg.Wait()
+	return err
+}
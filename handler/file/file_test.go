@@ -0,0 +1,295 @@
+package file
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/phemmer/sawmill"
+	"github.com/phemmer/sawmill/event"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sawmill-file")
+	require.NoError(t, err)
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestHandlerIface(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	h, err := New(filepath.Join(dir, "test.log"), 0600, "", Options{})
+	require.NoError(t, err)
+	defer h.Close()
+	assert.Implements(t, (*sawmill.Handler)(nil), h)
+}
+
+func TestNew_namePattern(t *testing.T) {
+	_, err := New("/nonexistent/test.log", 0600, "", Options{NamePattern: "{name}.old"})
+	assert.Error(t, err)
+}
+
+func TestHandler_Event(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "test.log")
+
+	h, err := New(path, 0600, "{{.Message}}", Options{})
+	require.NoError(t, err)
+	require.NoError(t, h.Event(event.New(0, event.Info, "foo", nil, false)))
+	require.NoError(t, h.Close())
+
+	assert.Equal(t, "foo\n", readFile(t, path))
+
+	// events after close are dropped
+	h.Event(event.New(0, event.Info, "bar", nil, false))
+	assert.Equal(t, "foo\n", readFile(t, path))
+}
+
+func TestHandler_maxSize(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	h, err := New(path, 0600, "", Options{MaxSize: 11})
+	require.NoError(t, err)
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	h.started = now
+
+	h.Write([]byte("12345\n"))
+	h.Write([]byte("1234\n"))
+	// would exceed MaxSize
+	now = now.Add(time.Minute)
+	h.Write([]byte("abc\n"))
+	// a single write larger than MaxSize goes into an empty file
+	now = now.Add(time.Minute)
+	h.Write([]byte("0123456789abc\n"))
+	require.NoError(t, h.Close())
+
+	assert.Equal(t, "0123456789abc\n", readFile(t, path))
+	assert.Equal(t, "12345\n1234\n", readFile(t, filepath.Join(dir, "test-20160102T030405.log")))
+	assert.Equal(t, "abc\n", readFile(t, filepath.Join(dir, "test-20160102T030505.log")))
+}
+
+func TestHandler_interval(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	h, err := New(path, 0600, "", Options{Interval: time.Hour, NamePattern: "{name}{ext}.{time}", TimeFormat: "2006010215"})
+	require.NoError(t, err)
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	h.started = now
+	h.nextRotation = h.rotationAfter(now)
+	assert.Equal(t, time.Date(2016, 1, 2, 4, 0, 0, 0, time.UTC), h.nextRotation)
+
+	h.Write([]byte("a\n"))
+	now = now.Add(30 * time.Minute)
+	h.Write([]byte("b\n"))
+	now = now.Add(30 * time.Minute)
+	h.Write([]byte("c\n"))
+	require.NoError(t, h.Close())
+
+	assert.Equal(t, "c\n", readFile(t, path))
+	assert.Equal(t, "a\nb\n", readFile(t, filepath.Join(dir, "test.log.2016010203")))
+}
+
+func TestHandler_rotationAfter(t *testing.T) {
+	h := &Handler{options: Options{Interval: 24 * time.Hour}}
+	loc := time.FixedZone("test", -5*60*60)
+	assert.Equal(t, time.Date(2016, 1, 3, 0, 0, 0, 0, loc), h.rotationAfter(time.Date(2016, 1, 2, 23, 4, 5, 0, loc)))
+
+	h.options.Interval = 0
+	assert.True(t, h.rotationAfter(time.Now()).IsZero())
+}
+
+func TestHandler_Rotate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	h, err := New(path, 0600, "", Options{})
+	require.NoError(t, err)
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	h.started = now
+
+	// nothing to rotate
+	require.NoError(t, h.Rotate())
+	backups, err := h.Backups()
+	require.NoError(t, err)
+	assert.Empty(t, backups)
+
+	h.Write([]byte("a\n"))
+	require.NoError(t, h.Rotate())
+	h.Write([]byte("b\n"))
+	// same start time, so the name gets a counter
+	h.started = now
+	require.NoError(t, h.Rotate())
+	require.NoError(t, h.Close())
+
+	assert.Equal(t, "a\n", readFile(t, filepath.Join(dir, "test-20160102T030405.log")))
+	assert.Equal(t, "b\n", readFile(t, filepath.Join(dir, "test-20160102T030405-1.log")))
+	assert.Equal(t, "", readFile(t, path))
+}
+
+func TestHandler_compress(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	h, err := New(path, 0600, "", Options{Compress: true})
+	require.NoError(t, err)
+	h.Write([]byte("a\n"))
+	require.NoError(t, h.Rotate())
+	require.NoError(t, h.Close())
+
+	backups, err := h.Backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	assert.Equal(t, ".gz", filepath.Ext(backups[0]))
+
+	f, err := os.Open(backups[0])
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, "a\n", string(data))
+}
+
+func TestHandler_retention(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	h, err := New(path, 0600, "", Options{MaxBackups: 2, MaxAge: 10 * 24 * time.Hour})
+	require.NoError(t, err)
+
+	// an old backup, which is beyond MaxAge
+	old := filepath.Join(dir, "test-20000101T000000.log")
+	require.NoError(t, ioutil.WriteFile(old, []byte("old\n"), 0600))
+	oldTime := time.Now().Add(-30 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(old, oldTime, oldTime))
+	// unrelated files are left alone
+	other := filepath.Join(dir, "other.log")
+	require.NoError(t, ioutil.WriteFile(other, nil, 0600))
+
+	h.Write([]byte("a\n"))
+	require.NoError(t, h.Rotate())
+	h.wg.Wait()
+	backups, err := h.Backups()
+	require.NoError(t, err)
+	assert.Len(t, backups, 1)
+	assert.False(t, exists(old))
+
+	for i := 0; i < 3; i++ {
+		h.Write([]byte("a\n"))
+		h.started = h.started.Add(-time.Duration(i+1) * time.Hour)
+		require.NoError(t, h.Rotate())
+	}
+	require.NoError(t, h.Close())
+
+	backups, err = h.Backups()
+	require.NoError(t, err)
+	assert.Len(t, backups, 2)
+	assert.True(t, exists(other))
+}
+
+func TestHandler_retentionCompressed(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.log")
+
+	// the backups glob (test.log.*) also matches the compressed backups
+	h, err := New(path, 0600, "", Options{NamePattern: "{name}{ext}.{time}", MaxBackups: 3, Compress: true})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		h.Write([]byte("a\n"))
+		h.started = h.started.Add(-time.Duration(i+1) * time.Hour)
+		require.NoError(t, h.Rotate())
+		h.wg.Wait()
+	}
+	require.NoError(t, h.Close())
+
+	backups, err := h.Backups()
+	require.NoError(t, err)
+	assert.Len(t, backups, 3)
+	for _, backup := range backups {
+		assert.Equal(t, ".gz", filepath.Ext(backup))
+	}
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 4)
+}
+
+func TestHandler_retentionSibling(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+
+	// another service's log, and its rotated file, also match the app-*.log glob
+	sibling := filepath.Join(dir, "app-access.log")
+	require.NoError(t, ioutil.WriteFile(sibling, nil, 0600))
+	siblingRotated := filepath.Join(dir, "app-access-20000101T000000.log")
+	require.NoError(t, ioutil.WriteFile(siblingRotated, nil, 0600))
+
+	h, err := New(path, 0600, "", Options{MaxBackups: 2})
+	require.NoError(t, err)
+
+	// the first two get the same time, so the second gets a "-1" suffix
+	for _, started := range []time.Time{time.Now().Add(-2 * time.Hour), time.Now().Add(-2 * time.Hour), time.Now().Add(-time.Hour)} {
+		h.Write([]byte("a\n"))
+		h.started = started
+		require.NoError(t, h.Rotate())
+	}
+	require.NoError(t, h.Close())
+
+	backups, err := h.Backups()
+	require.NoError(t, err)
+	assert.Len(t, backups, 2)
+	assert.True(t, exists(sibling))
+	assert.True(t, exists(siblingRotated))
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 5)
+}
+
+func TestHandler_removed(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "test.log")
+
+	h, err := New(path, 0600, "", Options{MaxSize: 100})
+	require.NoError(t, err)
+	now := time.Now()
+	h.now = func() time.Time { return now }
+
+	h.Write([]byte("a\n"))
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "sub")))
+
+	// not noticed until the next check
+	now = now.Add(statInterval)
+	_, err = h.Write([]byte("b\n"))
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+
+	assert.Equal(t, "b\n", readFile(t, path))
+}
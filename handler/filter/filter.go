@@ -25,6 +25,7 @@ type FilterFunc func(*event.Event) bool
 type FilterHandler struct {
 	nextHandler Handler
 	filterFuncs []FilterFunc
+	levelFuncs  []func(event.Level) bool
 }
 
 // New creates a new FilterHandler which relays events to the handler specified in `nextHandler`.
@@ -47,6 +48,24 @@ func (filterHandler *FilterHandler) Event(logEvent *event.Event) error {
 	return filterHandler.nextHandler.Event(logEvent)
 }
 
+// AcceptsLevel indicates whether events of the given level could pass through the filter.
+// This considers only the level filters (LevelMin() & LevelMax()), and the next handler if it also implements AcceptsLevel().
+//
+// Loggers use this to avoid generating events which no handler will accept.
+func (filterHandler *FilterHandler) AcceptsLevel(level event.Level) bool {
+	for _, levelFunc := range filterHandler.levelFuncs {
+		if !levelFunc(level) {
+			return false
+		}
+	}
+	if levelAccepter, ok := filterHandler.nextHandler.(interface {
+		AcceptsLevel(event.Level) bool
+	}); ok {
+		return levelAccepter.AcceptsLevel(level)
+	}
+	return true
+}
+
 // Filter adds a check function to the filter.
 //
 // The function is passed the event, and should return true if the event is allowed, and false otherwise.
@@ -62,12 +81,13 @@ func (filterHandler *FilterHandler) Filter(filterFuncs ...FilterFunc) *FilterHan
 //
 // The return value is the handler itself. This is to allow chaining multiple operations together.
 func (filterHandler *FilterHandler) LevelMin(levelMin event.Level) *FilterHandler {
+	levelFunc := func(level event.Level) bool {
+		return level >= levelMin
+	}
 	filterFunc := func(logEvent *event.Event) bool {
-		if logEvent.Level < levelMin {
-			return false
-		}
-		return true
+		return levelFunc(logEvent.Level)
 	}
+	filterHandler.levelFuncs = append(filterHandler.levelFuncs, levelFunc)
 
 	return filterHandler.Filter(filterFunc)
 }
@@ -76,12 +96,13 @@ func (filterHandler *FilterHandler) LevelMin(levelMin event.Level) *FilterHandle
 //
 // The return value is the handler itself. This is to allow chaining multiple operations together.
 func (filterHandler *FilterHandler) LevelMax(levelMax event.Level) *FilterHandler {
+	levelFunc := func(level event.Level) bool {
+		return level <= levelMax
+	}
 	filterFunc := func(logEvent *event.Event) bool {
-		if logEvent.Level > levelMax {
-			return false
-		}
-		return true
+		return levelFunc(logEvent.Level)
 	}
+	filterHandler.levelFuncs = append(filterHandler.levelFuncs, levelFunc)
 
 	return filterHandler.Filter(filterFunc)
 }
@@ -98,15 +119,23 @@ func (filterHandler *FilterHandler) LevelMax(levelMax event.Level) *FilterHandle
 func (filterHandler *FilterHandler) Dedup() *FilterHandler {
 	var lastLogEvent *event.Event
 	var dups int
+	setLast := func(logEvent *event.Event) {
+		// the last event is compared against the next one, so hold on to it
+		logEvent.Retain()
+		if lastLogEvent != nil {
+			lastLogEvent.Release()
+		}
+		lastLogEvent = logEvent
+	}
 	filterFunc := func(logEvent *event.Event) bool {
 		if lastLogEvent == nil {
-			lastLogEvent = logEvent
+			setLast(logEvent)
 			return true
 		}
 
 		if lastLogEvent.Message == logEvent.Message && reflect.DeepEqual(lastLogEvent.FlatFields, logEvent.FlatFields) {
 			dups++
-			lastLogEvent = logEvent
+			setLast(logEvent)
 			return false
 		}
 
@@ -122,7 +151,7 @@ func (filterHandler *FilterHandler) Dedup() *FilterHandler {
 		}
 
 		dups = 0
-		lastLogEvent = logEvent
+		setLast(logEvent)
 		return true
 	}
 
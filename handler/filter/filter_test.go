@@ -211,3 +211,21 @@ func TestDedup(t *testing.T) {
 
 	assert.Equal(t, testEvent2.Message, ch.Events()[2].Message)
 }
+
+func TestAcceptsLevel(t *testing.T) {
+	ch := capture.NewHandler()
+	filter := New(ch)
+	filter.Filter(func(e *event.Event) bool { return false })
+	assert.True(t, filter.AcceptsLevel(event.Debug))
+
+	filter.LevelMin(event.Notice).LevelMax(event.Error)
+	assert.False(t, filter.AcceptsLevel(event.Info))
+	assert.True(t, filter.AcceptsLevel(event.Notice))
+	assert.True(t, filter.AcceptsLevel(event.Error))
+	assert.False(t, filter.AcceptsLevel(event.Critical))
+
+	// chained filters
+	outer := New(New(ch).LevelMin(event.Warning))
+	assert.False(t, outer.AcceptsLevel(event.Notice))
+	assert.True(t, outer.AcceptsLevel(event.Warning))
+}
@@ -0,0 +1,243 @@
+// +build !windows
+
+/*
+The journald package is an event handler which sends events to the systemd journal, using its native protocol.
+
+Unlike sending through syslog, the event's fields are kept as separate journal fields, which can be queried with journalctl:
+
+ logger := sawmill.NewLogger()
+ h, err := journald.New("")
+ if err != nil {
+ 	sawmill.Panic("error connecting to journald", sawmill.Fields{"error": err})
+ }
+ logger.AddHandler("journald", h)
+
+ logger.Info("request", sawmill.Fields{"user": sawmill.Fields{"id": 1234}})
+
+ # journalctl USER_ID=1234
+*/
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/phemmer/sawmill/event"
+	"github.com/phemmer/sawmill/event/formatter"
+)
+
+// DefaultSocket is the path of journald's native protocol socket.
+const DefaultSocket = "/run/systemd/journal/socket"
+
+// maxFieldNameLength is the longest field name journald accepts.
+const maxFieldNameLength = 64
+
+// levelPriorityMap maps the standard levels to syslog priorities, which is what the journal uses.
+var levelPriorityMap = map[event.Level]int{
+	event.Debug:     7,
+	event.Info:      6,
+	event.Notice:    5,
+	event.Warning:   4,
+	event.Error:     3,
+	event.Critical:  2,
+	event.Alert:     1,
+	event.Emergency: 0,
+}
+
+// handlerFieldNames are the fields written by the handler itself, which the event's flat fields may not also use.
+var handlerFieldNames = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+}
+
+// JournaldHandler sends events to journald.
+//
+// Each event becomes a journal entry with the fields:
+//  MESSAGE             - The event's message.
+//  PRIORITY            - The syslog priority of the event's level.
+//  SYSLOG_IDENTIFIER   - The program name.
+//  CODE_FILE, CODE_LINE, CODE_FUNC - The location the event was logged from, if the event has a stack trace or caller info.
+//  Flat fields         - Each of the event's flat fields, e.g. "user.id" becomes USER_ID. See FieldName().
+// Flat fields whose name would be one of the fields above are omitted, so that they can't replace the message or priority.
+type JournaldHandler struct {
+	socketAddr *net.UnixAddr
+	conn       *net.UnixConn
+	identifier string
+}
+
+// New creates a handler which sends to the journald socket at the given path. If empty, DefaultSocket is used.
+// An error is returned if the socket does not exist, e.g. if the host does not run systemd.
+func New(socketPath string) (*JournaldHandler, error) {
+	if socketPath == "" {
+		socketPath = DefaultSocket
+	}
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, err
+	}
+
+	// an unconnected socket, so that a restart of journald does not break it
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &JournaldHandler{
+		socketAddr: &net.UnixAddr{Name: socketPath, Net: "unixgram"},
+		conn:       conn,
+		identifier: path.Base(os.Args[0]),
+	}, nil
+}
+
+// Event sends the event to journald.
+func (handler *JournaldHandler) Event(logEvent *event.Event) error {
+	return handler.send(handler.encode(logEvent))
+}
+
+// Close closes the handler's socket.
+func (handler *JournaldHandler) Close() error {
+	return handler.conn.Close()
+}
+
+// encode converts the event into the native journal protocol.
+func (handler *JournaldHandler) encode(logEvent *event.Event) []byte {
+	var buf bytes.Buffer
+	writeField(&buf, "MESSAGE", logEvent.Message)
+	writeField(&buf, "PRIORITY", strconv.Itoa(levelPriorityMap[logEvent.Level.Standard()]))
+	writeField(&buf, "SYSLOG_IDENTIFIER", handler.identifier)
+
+	caller := logEvent.Caller
+	if caller == nil && len(logEvent.Stack) > 0 {
+		caller = logEvent.Stack[0]
+	}
+	if caller != nil {
+		writeField(&buf, "CODE_FILE", caller.File)
+		writeField(&buf, "CODE_LINE", strconv.Itoa(caller.Line))
+		writeField(&buf, "CODE_FUNC", caller.Function)
+	}
+
+	eventFormatter := formatter.EventFormatter(logEvent)
+	for _, field := range eventFormatter.OrderedFields() {
+		name := FieldName(field.Key)
+		if handlerFieldNames[name] {
+			continue
+		}
+		writeField(&buf, name, eventFormatter.ToString(field.Value))
+	}
+	return buf.Bytes()
+}
+
+// writeField writes a single field in the native protocol.
+// Values containing a newline are written in the binary form: the name, a newline, the length of the value as a 64-bit little endian integer, then the value.
+func writeField(buf *bytes.Buffer, name string, value string) {
+	buf.WriteString(name)
+	if strings.IndexByte(value, '\n') == -1 {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// FieldName converts a flat field key into a valid journal field name.
+// The key is upper cased, and characters other than A-Z, 0-9 and underscore are replaced with underscores.
+// Leading underscores are removed, as they are reserved for fields set by journald, and names starting with a digit are prefixed with "F". Names are truncated to 64 characters.
+//
+// For example "user.id" becomes "USER_ID", and "_private" becomes "PRIVATE".
+func FieldName(key string) string {
+	name := make([]byte, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_':
+		default:
+			c = '_'
+		}
+		if c == '_' && len(name) == 0 {
+			continue
+		}
+		name = append(name, c)
+	}
+	if len(name) == 0 {
+		return "FIELD"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = append([]byte{'F'}, name...)
+	}
+	if len(name) > maxFieldNameLength {
+		name = name[:maxFieldNameLength]
+	}
+	return string(name)
+}
+
+// send sends an entry to journald.
+// Entries too large for a datagram are written to a memfd, or if that is not available, an unlinked temporary file, and the file descriptor is sent instead.
+func (handler *JournaldHandler) send(data []byte) error {
+	_, _, err := handler.conn.WriteMsgUnix(data, nil, handler.socketAddr)
+	if err == nil {
+		return nil
+	}
+	if !isTooLarge(err) {
+		return err
+	}
+
+	file, err := memfd(data)
+	if err != nil {
+		if file, err = tempFile(data); err != nil {
+			return err
+		}
+	}
+	defer file.Close()
+
+	_, _, err = handler.conn.WriteMsgUnix(nil, syscall.UnixRights(int(file.Fd())), handler.socketAddr)
+	return err
+}
+
+// isTooLarge determines whether the error is due to the datagram being too large for the socket.
+func isTooLarge(err error) bool {
+	var errno syscall.Errno
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			errno, _ = sysErr.Err.(syscall.Errno)
+		}
+	}
+	return errno == syscall.EMSGSIZE || errno == syscall.ENOBUFS
+}
+
+// tempFile writes the data to an unlinked temporary file. /dev/shm is preferred, as it is memory backed.
+func tempFile(data []byte) (*os.File, error) {
+	dir := "/dev/shm"
+	if _, err := os.Stat(dir); err != nil {
+		dir = ""
+	}
+	file, err := ioutil.TempFile(dir, "sawmill-journald")
+	if err != nil {
+		return nil, err
+	}
+	// unlinked, so that the file goes away once both we and journald have closed it
+	if err := os.Remove(file.Name()); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,214 @@
+// +build !windows
+
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/phemmer/sawmill"
+	"github.com/phemmer/sawmill/event"
+)
+
+type listener struct {
+	dir  string
+	conn *net.UnixConn
+}
+
+func newListener(t *testing.T) *listener {
+	dir, err := ioutil.TempDir("", "sawmill-journald")
+	require.NoError(t, err)
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "socket"), Net: "unixgram"})
+	require.NoError(t, err)
+	return &listener{dir: dir, conn: conn}
+}
+
+func (l *listener) Path() string {
+	return filepath.Join(l.dir, "socket")
+}
+
+func (l *listener) Close() {
+	l.conn.Close()
+	os.RemoveAll(l.dir)
+}
+
+// receive reads an entry, either from a datagram or a passed file descriptor.
+func (l *listener) receive(t *testing.T) []byte {
+	buf := make([]byte, 65536)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := l.conn.ReadMsgUnix(buf, oob)
+	require.NoError(t, err)
+	if oobn == 0 {
+		return buf[:n]
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	require.NoError(t, err)
+	require.Len(t, fds, 1)
+	file := os.NewFile(uintptr(fds[0]), "entry")
+	defer file.Close()
+	_, err = file.Seek(0, 0)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	return data
+}
+
+// parseEntry parses the native journal protocol.
+func parseEntry(t *testing.T, data []byte) map[string]string {
+	fields := map[string]string{}
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "=\n")
+		require.NotEqual(t, -1, i)
+		name := string(data[:i])
+		if data[i] == '=' {
+			data = data[i+1:]
+			end := bytes.IndexByte(data, '\n')
+			require.NotEqual(t, -1, end)
+			fields[name] = string(data[:end])
+			data = data[end+1:]
+			continue
+		}
+		data = data[i+1:]
+		length := binary.LittleEndian.Uint64(data)
+		data = data[8:]
+		fields[name] = string(data[:length])
+		require.Equal(t, byte('\n'), data[length])
+		data = data[length+1:]
+	}
+	return fields
+}
+
+func TestHandlerIface(t *testing.T) {
+	l := newListener(t)
+	defer l.Close()
+
+	h, err := New(l.Path())
+	require.NoError(t, err)
+	defer h.Close()
+	assert.Implements(t, (*sawmill.Handler)(nil), h)
+}
+
+func TestNew_noSocket(t *testing.T) {
+	_, err := New("/nonexistent/socket")
+	assert.Error(t, err)
+}
+
+func TestEvent(t *testing.T) {
+	l := newListener(t)
+	defer l.Close()
+
+	h, err := New(l.Path())
+	require.NoError(t, err)
+	defer h.Close()
+
+	e := event.NewWithFields(0, event.Warning, "a message", []event.Field{
+		{Key: "user", Value: map[string]interface{}{"id": 1234}},
+		{Key: "multi", Value: "line 1\nline 2"},
+	}, true)
+	require.NoError(t, h.Event(e))
+
+	fields := parseEntry(t, l.receive(t))
+	assert.Equal(t, "a message", fields["MESSAGE"])
+	assert.Equal(t, "4", fields["PRIORITY"])
+	assert.Equal(t, filepath.Base(os.Args[0]), fields["SYSLOG_IDENTIFIER"])
+	assert.Equal(t, "1234", fields["USER_ID"])
+	assert.Equal(t, "line 1\nline 2", fields["MULTI"])
+	assert.Equal(t, e.Stack[0].File, fields["CODE_FILE"])
+	assert.Equal(t, e.Stack[0].Function, fields["CODE_FUNC"])
+	assert.NotEmpty(t, fields["CODE_LINE"])
+}
+
+func TestEvent_handlerFieldNames(t *testing.T) {
+	l := newListener(t)
+	defer l.Close()
+
+	h, err := New(l.Path())
+	require.NoError(t, err)
+	defer h.Close()
+
+	e := event.New(0, event.Warning, "a message", map[string]interface{}{
+		"message":           "other",
+		"priority":          0,
+		"syslog_identifier": "other",
+		"code_file":         "other.go",
+		"n":                 1,
+	}, false)
+	require.NoError(t, h.Event(e))
+
+	data := l.receive(t)
+	for _, name := range []string{"MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER"} {
+		assert.Equal(t, 1, strings.Count("\n"+string(data), "\n"+name+"="), name)
+	}
+	fields := parseEntry(t, data)
+	assert.Equal(t, "a message", fields["MESSAGE"])
+	assert.Equal(t, "4", fields["PRIORITY"])
+	assert.NotContains(t, fields, "CODE_FILE")
+	assert.Equal(t, "1", fields["N"])
+}
+
+func TestEvent_customLevel(t *testing.T) {
+	l := newListener(t)
+	defer l.Close()
+
+	h, err := New(l.Path())
+	require.NoError(t, err)
+	defer h.Close()
+
+	require.NoError(t, h.Event(event.New(0, event.Level(10), "msg", nil, false)))
+	assert.Equal(t, "0", parseEntry(t, l.receive(t))["PRIORITY"])
+}
+
+func TestEvent_large(t *testing.T) {
+	l := newListener(t)
+	defer l.Close()
+
+	h, err := New(l.Path())
+	require.NoError(t, err)
+	defer h.Close()
+
+	large := strings.Repeat("x", 4*1024*1024)
+	require.NoError(t, h.Event(event.New(0, event.Info, "msg", map[string]interface{}{"large": large}, false)))
+
+	fields := parseEntry(t, l.receive(t))
+	assert.Equal(t, "msg", fields["MESSAGE"])
+	assert.Equal(t, large, fields["LARGE"])
+}
+
+func TestTempFile(t *testing.T) {
+	file, err := tempFile([]byte("data"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	// the file is unlinked
+	_, err = os.Stat(file.Name())
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = file.Seek(0, 0)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestFieldName(t *testing.T) {
+	assert.Equal(t, "USER_ID", FieldName("user.id"))
+	assert.Equal(t, "PRIVATE", FieldName("_private"))
+	assert.Equal(t, "F0", FieldName("0"))
+	assert.Equal(t, "FOO_BAR", FieldName("foo-bar"))
+	assert.Equal(t, "FIELD", FieldName("."))
+	assert.Equal(t, strings.Repeat("A", 64), FieldName(strings.Repeat("a", 100)))
+}
@@ -0,0 +1,26 @@
+package journald
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// memfd writes the data to a sealed memfd, which is journald's preferred way of receiving large entries.
+func memfd(data []byte) (*os.File, error) {
+	fd, err := unix.MemfdCreate("sawmill-journald", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, err
+	}
+	file := os.NewFile(uintptr(fd), "sawmill-journald")
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, err
+	}
+	// journald refuses memfds which could still be modified
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,25 @@
+package journald
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemfd(t *testing.T) {
+	file, err := memfd([]byte("data"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	// sealed against modification
+	_, err = file.Write([]byte("more"))
+	assert.Error(t, err)
+
+	_, err = file.Seek(0, 0)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
@@ -0,0 +1,15 @@
+// +build !linux,!windows
+
+package journald
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoMemfd = errors.New("memfd not supported on this platform")
+
+// memfd is only available on linux. The caller falls back to a temporary file.
+func memfd(data []byte) (*os.File, error) {
+	return nil, errNoMemfd
+}
@@ -136,9 +136,12 @@ func ravenTrace(repoPath string, stack []*event.StackFrame) *raven.Stacktrace {
 // Event sends the given log event to the sentry service.
 func (s *Sentry) Event(logEvent *event.Event) error {
 	message := logEvent.Message
+	var errMessage, errType interface{}
 	if err, ok := logEvent.FlatFields["error"]; ok {
+		errMessage, errType = err, logEvent.FlatFields["error.type"]
 		message = fmt.Sprintf("%s: %v", message, err)
 	} else if err, ok := logEvent.FlatFields["err"]; ok {
+		errMessage, errType = err, logEvent.FlatFields["err.type"]
 		message = fmt.Sprintf("%s: %v", message, err)
 	}
 
@@ -147,7 +150,7 @@ func (s *Sentry) Event(logEvent *event.Event) error {
 	packet.Logger = "sawmill"
 	packet.EventID = s.idPrefix + strconv.FormatInt(int64(logEvent.Id), 10)
 	packet.Timestamp = raven.Timestamp(logEvent.Time)
-	packet.Level = ravenLevels[logEvent.Level]
+	packet.Level = ravenLevels[logEvent.Level.Standard()]
 	for k, v := range logEvent.FlatFields {
 		packet.Extra[k] = v
 	}
@@ -157,7 +160,17 @@ func (s *Sentry) Event(logEvent *event.Event) error {
 	}
 
 	// translate logEvent.Stack into raven.Stacktrace
-	packet.Interfaces = append(packet.Interfaces, ravenTrace(s.repoRoot, logEvent.Stack))
+	trace := ravenTrace(s.repoRoot, logEvent.Stack)
+	if errType, ok := errType.(string); ok {
+		// the event was logged with an error, so report it as an exception of the error's type
+		packet.Interfaces = append(packet.Interfaces, &raven.Exception{
+			Type:       errType,
+			Value:      fmt.Sprintf("%v", errMessage),
+			Stacktrace: trace,
+		})
+	} else {
+		packet.Interfaces = append(packet.Interfaces, trace)
+	}
 
 	_, errChan := s.client.Capture(packet, nil)
 	err := <-errChan
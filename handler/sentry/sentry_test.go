@@ -46,6 +46,14 @@ func TestSentryHandler(t *testing.T) {
 	haveStacktrace := false
 	for _, iface := range packet.Interfaces {
 		switch iface := iface.(type) {
+		case *raven.Exception:
+			assert.Equal(t, "*errors.errorString", iface.Type)
+			assert.Equal(t, "foo", iface.Value)
+			require.NotNil(t, iface.Stacktrace)
+			haveStacktrace = true
+			frame := iface.Stacktrace.Frames[len(iface.Stacktrace.Frames)-1]
+			assert.Equal(t, "handler/sentry/sentry_test.go", frame.Filename)
+			assert.Equal(t, "TestSentryHandler", frame.Function)
 		case *raven.Stacktrace:
 			haveStacktrace = true
 			frame := iface.Frames[len(iface.Frames)-1]
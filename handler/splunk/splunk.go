@@ -6,7 +6,7 @@ The CA cert for Splunk cloud is already recognized.
 
 Template
 
-The splunk template provides a few extra functions on top of the default sawmill event formatter template.
+The splunk template provides a few extra functions on top of those provided by the sawmill event formatter (see formatter.FuncMap()).
 
  Hostname - The system hostname (os.Hostname())
  Source - The application name (path.Base(os.Argv[0]))
@@ -33,7 +33,7 @@ import (
 
 // SplunkFormat is the default template format.
 // It is meant to work with the 'syslog' splunk sourcetype, such that the splunk field extraction matches most of the headers. The only header not properly parsed is the level.
-const SplunkFormat = "{{.Time \"2006-01-02 15:04:05.000 -0700\"}} {{.Level}}({{.Event.Level.Int}}) {{Source}}[{{Pid}}]: " + formatter.SIMPLE_FORMAT
+const SplunkFormat = "{{.Time \"2006-01-02 15:04:05.000 -0700\"}} {{.Level}}({{.Event.Level.Int}}) {{Source}}[{{Pid}}]: {{template \"simple\" .}}"
 
 // SplunkSourceType is the default splunk source type
 const SplunkSourceType = "syslog"
@@ -108,9 +108,7 @@ func New(splunkURL string) (*SplunkHandler, error) {
 	sw.Source = path.Base(os.Args[0])
 	setQueryParam(&sw.Source, "source")
 
-	//TODO redo all the formatter stuff so that it's more reusable.
-	//     Meaning make it so the splunk template can call the standard event template as a subtemplate.
-	sw.Template = template.New("splunk")
+	sw.Template = formatter.Template("splunk")
 	funcMap := template.FuncMap{
 		"Hostname": func() string { return sw.Hostname },
 		"Source":   func() string { return sw.Source },
@@ -0,0 +1,227 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// Oversize is what to do with messages larger than the maximum message size. See WithMaxMessageSize().
+// With FormatRFC5424, if the structured data leaves no room for the message, its params are first dropped from the end.
+type Oversize int
+
+const (
+	// OversizeTruncate cuts the message short, ending it with OversizeMarker. This is the default.
+	OversizeTruncate Oversize = iota
+	// OversizeSplit sends the message as multiple messages, each with the full header. All but the last end with OversizeMarker.
+	OversizeSplit
+)
+
+// OversizeMarker is appended to messages which were truncated, or which continue in the next message.
+const OversizeMarker = "..."
+
+// The default maximum message sizes, including the header, for the datagram transports.
+// 2048 is what RFC 5426 says receivers should support. Local syslog daemons commonly accept 8192.
+const (
+	DefaultUDPMessageSize      = 2048
+	DefaultUnixgramMessageSize = 8192
+)
+
+// facilityNames maps the names used by syslog.conf to the facilities.
+var facilityNames = map[string]facility{
+	"kern":     KERN,
+	"user":     USER,
+	"mail":     MAIL,
+	"daemon":   DAEMON,
+	"auth":     AUTH,
+	"syslog":   SYSLOG,
+	"lpr":      LPR,
+	"news":     NEWS,
+	"uucp":     UUCP,
+	"cron":     CRON,
+	"authpriv": AUTHPRIV,
+	"ftp":      FTP,
+	"local0":   LOCAL0,
+	"local1":   LOCAL1,
+	"local2":   LOCAL2,
+	"local3":   LOCAL3,
+	"local4":   LOCAL4,
+	"local5":   LOCAL5,
+	"local6":   LOCAL6,
+	"local7":   LOCAL7,
+}
+
+// WithTag sets the tag (the APP-NAME in RFC 5424) identifying the program. The default is the base name of os.Args[0].
+func WithTag(tag string) Option {
+	return func(sw *SyslogHandler) {
+		sw.syslogTag = tag
+	}
+}
+
+// WithHostname sets the hostname sent in the header. The default is os.Hostname().
+func WithHostname(hostname string) Option {
+	return func(sw *SyslogHandler) {
+		sw.syslogHostname = hostname
+	}
+}
+
+// WithIncludeHostname sets whether the hostname is sent in the RFC 3164 format. RFC 5424 messages always include it.
+// The default is false, as local syslog daemons add their own hostname, and some do not expect one from the client. It is useful when sending to a remote collector.
+func WithIncludeHostname(include bool) Option {
+	return func(sw *SyslogHandler) {
+		sw.includeHostname = include
+	}
+}
+
+// WithProcID sets the process ID sent after the tag. The default is os.Getpid(). An empty ID omits it.
+func WithProcID(procID string) Option {
+	return func(sw *SyslogHandler) {
+		sw.syslogProcID = procID
+	}
+}
+
+// WithFacilityField overrides the facility for events which have the given flat field, e.g. "syslog.facility".
+// The field's value may be a facility name such as "local0" or "daemon", or a facility code (0-23), e.g. 16 for local0. Events with an invalid value use the handler's facility.
+func WithFacilityField(key string) Option {
+	return func(sw *SyslogHandler) {
+		sw.facilityField = key
+	}
+}
+
+// WithMaxMessageSize sets the maximum size in bytes of a message, including the header, on the datagram transports ("udp" and "unixgram"). Stream transports are not limited.
+// The defaults are DefaultUDPMessageSize and DefaultUnixgramMessageSize.
+func WithMaxMessageSize(size int) Option {
+	return func(sw *SyslogHandler) {
+		sw.maxMessageSize = size
+	}
+}
+
+// WithOversize sets what to do with messages larger than the maximum message size. The default is OversizeTruncate.
+func WithOversize(oversize Oversize) Option {
+	return func(sw *SyslogHandler) {
+		sw.oversize = oversize
+	}
+}
+
+// eventFacility returns the facility for the event, which is the handler's unless overridden by the facility field.
+func (sw *SyslogHandler) eventFacility(logEvent *event.Event) facility {
+	if sw.facilityField == "" {
+		return sw.syslogFacility
+	}
+	value, ok := logEvent.FlatFields[sw.facilityField]
+	if !ok {
+		return sw.syslogFacility
+	}
+	if f, ok := parseFacility(value); ok {
+		return f
+	}
+	return sw.syslogFacility
+}
+
+// parseFacility converts a field value, either a name or a code, into a facility.
+func parseFacility(value interface{}) (facility, bool) {
+	str := fmt.Sprint(value)
+	if f, ok := facilityNames[strings.ToLower(str)]; ok {
+		return f, true
+	}
+	code, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, false
+	}
+	if code < 0 || code > int(LOCAL7>>3) {
+		return 0, false
+	}
+	return facility(code << 3), true
+}
+
+// maxSize returns the maximum message size for the current connection, or 0 if unlimited.
+func (sw *SyslogHandler) maxSize() int {
+	var size int
+	switch sw.network {
+	case "udp", "udp4", "udp6":
+		size = DefaultUDPMessageSize
+	case "unixgram":
+		size = DefaultUnixgramMessageSize
+	default:
+		return 0
+	}
+	if sw.maxMessageSize > 0 {
+		size = sw.maxMessageSize
+	}
+	return size
+}
+
+// maxHeaderSize returns the largest header which leaves room in the maximum message size for some of a message of the given length, or 0 if unlimited.
+// sw.mutex must be held.
+func (sw *SyslogHandler) maxHeaderSize(messageLength int) int {
+	limit := sw.maxSize()
+	if limit == 0 {
+		return 0
+	}
+	size := limit - 1
+	if messageLength > 0 {
+		// at least 1 byte of the message, followed by the marker
+		size -= 1 + len(OversizeMarker)
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// fit joins the header and message into newline terminated messages no larger than the maximum message size, truncating or splitting the message as needed.
+// sw.mutex must be held.
+func (sw *SyslogHandler) fit(header []byte, message []byte) [][]byte {
+	build := func(parts ...[]byte) []byte {
+		data := append([]byte{}, header...)
+		for _, part := range parts {
+			data = append(data, part...)
+		}
+		return append(data, '\n')
+	}
+
+	limit := sw.maxSize()
+	if limit == 0 || len(header)+len(message)+1 <= limit {
+		return [][]byte{build(message)}
+	}
+
+	room := limit - len(header) - len(OversizeMarker) - 1
+	if room <= 0 {
+		// not even the header fits, after dropping any structured data. Send what we can rather than nothing.
+		data := build()
+		if len(data) > limit {
+			data = append(data[:limit-1], '\n')
+		}
+		return [][]byte{data}
+	}
+
+	marker := []byte(OversizeMarker)
+	if sw.oversize != OversizeSplit {
+		return [][]byte{build(message[:cutPoint(message, room)], marker)}
+	}
+
+	var messages [][]byte
+	for len(header)+len(message)+1 > limit {
+		n := cutPoint(message, room)
+		messages = append(messages, build(message[:n], marker))
+		message = message[n:]
+	}
+	return append(messages, build(message))
+}
+
+// cutPoint returns the largest length <= n at which message can be cut without splitting a UTF-8 character.
+func cutPoint(message []byte, n int) int {
+	if n >= len(message) {
+		return len(message)
+	}
+	for i := n; i > n-utf8.UTFMax && i > 0; i-- {
+		if utf8.RuneStart(message[i]) {
+			return i
+		}
+	}
+	// not valid UTF-8. Cut anywhere.
+	return n
+}
@@ -0,0 +1,198 @@
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// newUDPListener returns a socket for receiving datagrams on the loopback.
+func newUDPListener(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return conn
+}
+
+func receiveDatagram(t *testing.T, conn net.PacketConn) string {
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestEvent_identity(t *testing.T) {
+	l, err := newUNIXListener()
+	require.NoError(t, err)
+	defer l.Close()
+
+	handler, err := New("", l.Addr, DAEMON, "{{.Message}}", WithTag("myservice"), WithHostname("myhost"), WithIncludeHostname(true), WithProcID("abc"))
+	require.NoError(t, err)
+
+	logEvent := event.New(1, event.Warning, "msg", nil, false)
+	require.NoError(t, handler.Event(logEvent))
+	assert.Equal(t, "<28>"+logEvent.Time.Format(time.StampMilli)+" myhost myservice[abc]: msg", <-l.MsgChan)
+
+	handler.syslogProcID = ""
+	require.NoError(t, handler.Event(logEvent))
+	assert.Equal(t, "<28>"+logEvent.Time.Format(time.StampMilli)+" myhost myservice: msg", <-l.MsgChan)
+
+	handler.syslogFormat = FormatRFC5424
+	logEvent.Time = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, handler.Event(logEvent))
+	assert.Equal(t, "<28>1 2016-01-02T03:04:05.000000Z myhost myservice - - - msg", <-l.MsgChan)
+}
+
+func TestEvent_facilityField(t *testing.T) {
+	l, err := newUNIXListener()
+	require.NoError(t, err)
+	defer l.Close()
+
+	handler, err := New("", l.Addr, DAEMON, "{{.Message}}", WithFacilityField("syslog.facility"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		value    interface{}
+		priority string
+	}{
+		{16, "<132>"},
+		{"local7", "<188>"},
+		{"MAIL", "<20>"},
+		{4, "<36>"},
+		{"23", "<188>"},
+		{24, "<28>"},
+		{"bogus", "<28>"},
+		{-1, "<28>"},
+	}
+	for _, test := range tests {
+		fields := map[string]interface{}{"syslog": map[string]interface{}{"facility": test.value}}
+		require.NoError(t, handler.Event(event.New(1, event.Warning, "msg", fields, false)))
+		msg := <-l.MsgChan
+		assert.True(t, strings.HasPrefix(msg, test.priority), "%v: %s", test.value, msg)
+	}
+
+	require.NoError(t, handler.Event(event.New(1, event.Warning, "msg", nil, false)))
+	msg := <-l.MsgChan
+	assert.True(t, strings.HasPrefix(msg, "<28>"), msg)
+}
+
+func TestEvent_udpTruncate(t *testing.T) {
+	conn := newUDPListener(t)
+	defer conn.Close()
+
+	handler, err := New("udp", conn.LocalAddr().String(), DAEMON, "{{.Message}}", WithTag("t"), WithProcID(""))
+	require.NoError(t, err)
+	defer handler.Close()
+
+	logEvent := event.New(1, event.Warning, strings.Repeat("x", 4000), nil, false)
+	require.NoError(t, handler.Event(logEvent))
+
+	msg := receiveDatagram(t, conn)
+	assert.Len(t, msg, DefaultUDPMessageSize)
+	assert.True(t, strings.HasSuffix(msg, "x"+OversizeMarker+"\n"), msg)
+
+	// small messages are untouched
+	logEvent = event.New(1, event.Warning, "msg", nil, false)
+	require.NoError(t, handler.Event(logEvent))
+	assert.Equal(t, "<28>"+logEvent.Time.Format(time.StampMilli)+" t: msg\n", receiveDatagram(t, conn))
+}
+
+func TestEvent_udpSplit(t *testing.T) {
+	conn := newUDPListener(t)
+	defer conn.Close()
+
+	handler, err := New("udp", conn.LocalAddr().String(), DAEMON, "{{.Message}}", WithTag("t"), WithProcID(""), WithMaxMessageSize(40), WithOversize(OversizeSplit))
+	require.NoError(t, err)
+	defer handler.Close()
+
+	logEvent := event.New(1, event.Warning, "0123456789abcdefghijklmnopqrstuvwxyz", nil, false)
+	require.NoError(t, handler.Event(logEvent))
+
+	// the header is 27 bytes, leaving 40-27-3-1 = 9 bytes of message per datagram.
+	header := "<28>" + logEvent.Time.Format(time.StampMilli) + " t: "
+	require.Len(t, header, 27)
+	assert.Equal(t, header+"012345678...\n", receiveDatagram(t, conn))
+	assert.Equal(t, header+"9abcdefgh...\n", receiveDatagram(t, conn))
+	assert.Equal(t, header+"ijklmnopq...\n", receiveDatagram(t, conn))
+	assert.Equal(t, header+"rstuvwxyz\n", receiveDatagram(t, conn))
+}
+
+func TestEvent_rfc5424Oversize(t *testing.T) {
+	conn := newUDPListener(t)
+	defer conn.Close()
+
+	handler, err := New("udp", conn.LocalAddr().String(), DAEMON, "{{.Message}}", WithFormat(FormatRFC5424), WithHostname("h"), WithTag("t"), WithProcID(""), WithMaxMessageSize(80))
+	require.NoError(t, err)
+	defer handler.Close()
+
+	// the params from the one which doesn't fit onwards are dropped, and the message is truncated.
+	logEvent := event.NewWithFields(1, event.Warning, strings.Repeat("x", 100), []event.Field{
+		{Key: "a", Value: "1"},
+		{Key: "big", Value: strings.Repeat("y", 500)},
+		{Key: "c", Value: "3"},
+	}, false)
+	logEvent.Time = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, handler.Event(logEvent))
+	msg := receiveDatagram(t, conn)
+	assert.Equal(t, `<28>1 2016-01-02T03:04:05.000000Z h t - - [sawmill@32473 a="1"] xxxxxxxxxxxx...`+"\n", msg)
+	assert.Len(t, msg, 80)
+
+	// no params fit
+	logEvent = event.New(1, event.Warning, "msg", map[string]interface{}{"big": strings.Repeat("y", 500)}, false)
+	logEvent.Time = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, handler.Event(logEvent))
+	assert.Equal(t, "<28>1 2016-01-02T03:04:05.000000Z h t - - - msg\n", receiveDatagram(t, conn))
+}
+
+func TestEvent_streamNotLimited(t *testing.T) {
+	l, err := newTCPListener()
+	require.NoError(t, err)
+	defer l.Close()
+
+	handler, err := New("tcp", l.Addr, DAEMON, "{{.Message}}", WithMaxMessageSize(40))
+	require.NoError(t, err)
+
+	message := strings.Repeat("x", 4000)
+	require.NoError(t, handler.Event(event.New(1, event.Warning, message, nil, false)))
+	assert.True(t, strings.HasSuffix(<-l.MsgChan, message))
+}
+
+func TestSyslogHandler_fit(t *testing.T) {
+	handler := &SyslogHandler{network: "unixgram", maxMessageSize: 10}
+	header := []byte("<1>")
+
+	// 3 bytes of room, after the header, marker & newline.
+	assert.Equal(t, [][]byte{[]byte("<1>abc...\n")}, handler.fit(header, []byte("abcdefgh")))
+	// the 3 byte rune is not cut
+	assert.Equal(t, [][]byte{[]byte("<1>a...\n")}, handler.fit(header, []byte("a€bcdefg")))
+
+	handler.oversize = OversizeSplit
+	var parts []string
+	for _, part := range handler.fit(header, []byte("a€€b")) {
+		parts = append(parts, string(part))
+	}
+	assert.Equal(t, []string{"<1>a...\n", "<1>€...\n", "<1>€b\n"}, parts)
+
+	// the header alone is too large
+	assert.Equal(t, [][]byte{[]byte("<1>456789\n")}, handler.fit([]byte("<1>4567890123"), []byte("msg")))
+}
+
+func TestParseFacility(t *testing.T) {
+	for name, f := range facilityNames {
+		parsed, ok := parseFacility(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, f, parsed, name)
+		parsed, ok = parseFacility(fmt.Sprint(int(f >> 3)))
+		assert.True(t, ok, name)
+		assert.Equal(t, f, parsed, name)
+	}
+	_, ok := parseFacility(-1)
+	assert.False(t, ok)
+}
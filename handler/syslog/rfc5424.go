@@ -0,0 +1,172 @@
+package syslog
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/phemmer/sawmill/event"
+	"github.com/phemmer/sawmill/event/formatter"
+)
+
+// Format is the format of the syslog messages.
+type Format int
+
+const (
+	// FormatRFC3164 is the traditional BSD syslog format. This is the default.
+	//  <28>Jan  2 03:04:05.000 myapp[1234]: message
+	FormatRFC3164 Format = iota
+	// FormatRFC5424 is the IETF syslog format, which adds the year & timezone to the timestamp, and sends the event's flat fields as structured data.
+	//  <28>1 2016-01-02T03:04:05.000000Z myhost myapp 1234 - [sawmill@32473 user.id="1234"] message
+	FormatRFC5424
+)
+
+// DefaultStructuredDataID is the SD-ID under which the event's fields are sent in the RFC 5424 format.
+// 32473 is the private enterprise number reserved for documentation (RFC 5612). Organizations with their own number may wish to use it instead via WithStructuredDataID().
+const DefaultStructuredDataID = "sawmill@32473"
+
+// The maximum lengths of the RFC 5424 header fields.
+const (
+	maxHostnameLength = 255
+	maxAppNameLength  = 48
+	maxProcIDLength   = 128
+	maxMsgIDLength    = 32
+	maxSDNameLength   = 32
+)
+
+// rfc5424TimeFormat is RFC 3339 with microseconds, the highest precision RFC 5424 allows.
+const rfc5424TimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// Option configures a SyslogHandler. Options are passed to New().
+type Option func(*SyslogHandler)
+
+// WithFormat selects the format of the messages. The default is FormatRFC3164.
+func WithFormat(format Format) Option {
+	return func(sw *SyslogHandler) {
+		sw.syslogFormat = format
+	}
+}
+
+// WithStructuredDataID sets the SD-ID under which the event's fields are sent in the RFC 5424 format. The default is DefaultStructuredDataID.
+// An empty ID disables sending the fields as structured data.
+func WithStructuredDataID(sdID string) Option {
+	return func(sw *SyslogHandler) {
+		sw.sdID = sdID
+	}
+}
+
+// WithMsgID sets the MSGID of messages in the RFC 5424 format, which identifies the type of message. The default is to send none.
+func WithMsgID(msgID string) Option {
+	return func(sw *SyslogHandler) {
+		sw.msgID = msgID
+	}
+}
+
+// formatRFC5424Header builds the header of a message in the RFC 5424 format:
+//  <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA
+// followed by a space if there is a message.
+// If maxLength is not 0, structured data params are dropped to keep the header within it.
+func (sw *SyslogHandler) formatRFC5424Header(priority int, logEvent *event.Event, hasMessage bool, maxLength int) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('<')
+	buf.WriteString(strconv.Itoa(priority))
+	buf.WriteString(">1 ")
+	buf.WriteString(logEvent.Time.Format(rfc5424TimeFormat))
+	buf.WriteByte(' ')
+	writeHeaderField(&buf, sw.syslogHostname, maxHostnameLength)
+	buf.WriteByte(' ')
+	writeHeaderField(&buf, sw.syslogTag, maxAppNameLength)
+	buf.WriteByte(' ')
+	writeHeaderField(&buf, sw.syslogProcID, maxProcIDLength)
+	buf.WriteByte(' ')
+	writeHeaderField(&buf, sw.msgID, maxMsgIDLength)
+	buf.WriteByte(' ')
+	sdMaxLength := maxLength
+	if maxLength > 0 && hasMessage {
+		// leave room for the space
+		sdMaxLength--
+	}
+	if maxLength > 0 && sdMaxLength < 1 {
+		sdMaxLength = 1
+	}
+	sw.writeStructuredData(&buf, logEvent, sdMaxLength)
+	if hasMessage {
+		buf.WriteByte(' ')
+	}
+	return buf.Bytes()
+}
+
+// writeHeaderField writes a header field, which is limited to printable US-ASCII. An empty value is written as the NILVALUE ("-").
+func writeHeaderField(buf *bytes.Buffer, value string, maxLength int) {
+	start := buf.Len()
+	for i := 0; i < len(value) && buf.Len()-start < maxLength; i++ {
+		if c := value[i]; c >= 33 && c <= 126 {
+			buf.WriteByte(c)
+		}
+	}
+	if buf.Len() == start {
+		buf.WriteByte('-')
+	}
+}
+
+// writeSDName writes an SD-ID or PARAM-NAME, which are printable US-ASCII, excluding '=', ' ', ']' and '"'.
+func writeSDName(buf *bytes.Buffer, name string) {
+	start := buf.Len()
+	for i := 0; i < len(name) && buf.Len()-start < maxSDNameLength; i++ {
+		c := name[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	if buf.Len() == start {
+		buf.WriteByte('_')
+	}
+}
+
+// writeStructuredData writes the event's flat fields as a single SD-ELEMENT:
+//  [sdid key="value" key2="value2"]
+// or the NILVALUE if there are none.
+//
+// If maxLength is not 0, params are dropped from the end so that buf does not grow beyond maxLength. If no params fit, the NILVALUE is written.
+func (sw *SyslogHandler) writeStructuredData(buf *bytes.Buffer, logEvent *event.Event, maxLength int) {
+	eventFormatter := formatter.EventFormatter(logEvent)
+	fields := eventFormatter.OrderedFields()
+	if sw.sdID == "" || len(fields) == 0 {
+		buf.WriteByte('-')
+		return
+	}
+
+	start := buf.Len()
+	buf.WriteByte('[')
+	writeSDName(buf, sw.sdID)
+	fitted, params := buf.Len(), 0
+	for _, field := range fields {
+		buf.WriteByte(' ')
+		writeSDName(buf, field.Key)
+		buf.WriteString(`="`)
+		value := eventFormatter.ToString(field.Value)
+		for i := 0; i < len(value); i++ {
+			switch c := value[i]; c {
+			case '"', '\\', ']':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		buf.WriteByte('"')
+		if maxLength > 0 && buf.Len()+1 > maxLength {
+			// the param and closing bracket don't fit. Drop it and the rest.
+			buf.Truncate(fitted)
+			break
+		}
+		fitted = buf.Len()
+		params++
+	}
+	if params == 0 {
+		buf.Truncate(start)
+		buf.WriteByte('-')
+		return
+	}
+	buf.WriteByte(']')
+}
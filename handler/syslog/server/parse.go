@@ -0,0 +1,339 @@
+package server
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// defaultPriority is the priority of messages without one, user.notice, as specified by RFC 3164.
+const defaultPriority = 13
+
+// utf8BOM may precede the MSG of RFC 5424 messages to indicate it is UTF-8.
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+// facilityNames are the names of the facilities, indexed by code.
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "clock",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// severityLevels maps the syslog severities to the event levels.
+var severityLevels = []event.Level{
+	event.Emergency,
+	event.Alert,
+	event.Critical,
+	event.Error,
+	event.Warning,
+	event.Notice,
+	event.Info,
+	event.Debug,
+}
+
+// message is a parsed syslog message.
+type message struct {
+	priority       int
+	time           time.Time
+	hostname       string
+	appName        string
+	procID         string
+	msgID          string
+	structuredData []sdElement
+	text           []byte
+}
+
+type sdElement struct {
+	id     string
+	params []sdParam
+}
+
+type sdParam struct {
+	name  string
+	value string
+}
+
+// Parse converts a syslog message, in either the RFC 3164 or RFC 5424 format, into an event.
+//
+// Parsing is lenient, as syslog senders often deviate from the RFCs. Parts of the message which cannot be parsed are left in the event's message, and a message without a priority is treated as user.notice.
+// The time is that of the message, or the current time if it has none.
+//
+// The event's level is the message's severity, and the fields are:
+//  syslog.facility - The facility name, e.g. "daemon".
+//  syslog.hostname, syslog.app_name, syslog.proc_id, syslog.msg_id - The header fields which were present. For RFC 3164 messages, app_name & proc_id are the tag & pid.
+//  <SD-ID>.<PARAM-NAME> - The structured data of RFC 5424 messages.
+//
+// The parameters of the structured data element with the given SD-ID are instead placed directly in the fields. Using the SD-ID of the sending syslog.SyslogHandler gives back the fields of the original event.
+func Parse(data []byte, sdID string) *event.Event {
+	msg := parse(data)
+
+	var fields []event.Field
+	for _, element := range msg.structuredData {
+		if element.id == sdID {
+			for _, param := range element.params {
+				fields = append(fields, event.Field{Key: param.name, Value: param.value})
+			}
+			continue
+		}
+		params := make(map[string]interface{}, len(element.params))
+		for _, param := range element.params {
+			params[param.name] = param.value
+		}
+		fields = append(fields, event.Field{Key: element.id, Value: params})
+	}
+
+	syslogFields := map[string]interface{}{"facility": facilityNames[msg.priority>>3]}
+	for key, value := range map[string]string{
+		"hostname": msg.hostname,
+		"app_name": msg.appName,
+		"proc_id":  msg.procID,
+		"msg_id":   msg.msgID,
+	} {
+		if value != "" {
+			syslogFields[key] = value
+		}
+	}
+	fields = append(fields, event.Field{Key: "syslog", Value: syslogFields})
+
+	logEvent := event.NewWithFields(0, severityLevels[msg.priority&7], string(msg.text), fields, false)
+	logEvent.Time = msg.time
+	return logEvent
+}
+
+// parse splits the message into its parts.
+func parse(data []byte) *message {
+	data = bytes.TrimRight(data, "\r\n\x00")
+	msg := &message{priority: defaultPriority}
+
+	priority, rest, ok := parsePriority(data)
+	if !ok {
+		msg.time = time.Now()
+		msg.text = data
+		return msg
+	}
+	msg.priority = priority
+
+	if bytes.HasPrefix(rest, []byte("1 ")) {
+		parseRFC5424(msg, rest[2:])
+	} else {
+		parseRFC3164(msg, rest)
+	}
+	return msg
+}
+
+// parsePriority parses the "<PRI>" at the start of the message.
+func parsePriority(data []byte) (int, []byte, bool) {
+	if len(data) < 3 || data[0] != '<' {
+		return 0, data, false
+	}
+	head := data
+	if len(head) > 5 {
+		head = head[:5]
+	}
+	end := bytes.IndexByte(head, '>')
+	if end < 2 {
+		return 0, data, false
+	}
+	priority, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || priority < 0 || priority >= len(facilityNames)<<3 {
+		return 0, data, false
+	}
+	return priority, data[end+1:], true
+}
+
+// parseRFC5424 parses everything after the version:
+//  TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseRFC5424(msg *message, data []byte) {
+	var timestamp []byte
+	timestamp, data = nextWord(data)
+	if t, err := time.Parse(time.RFC3339Nano, string(timestamp)); err == nil {
+		msg.time = t
+	} else {
+		msg.time = time.Now()
+	}
+
+	for _, field := range []*string{&msg.hostname, &msg.appName, &msg.procID, &msg.msgID} {
+		var value []byte
+		value, data = nextWord(data)
+		if string(value) != "-" {
+			*field = string(value)
+		}
+	}
+
+	if bytes.HasPrefix(data, []byte("-")) {
+		data = data[1:]
+	} else {
+		msg.structuredData, data = parseStructuredData(data)
+	}
+
+	if len(data) > 0 && data[0] == ' ' {
+		data = data[1:]
+	}
+	msg.text = bytes.TrimPrefix(data, utf8BOM)
+}
+
+// parseStructuredData parses SD-ELEMENTs for as long as they are valid, and returns the rest of the data:
+//  [SD-ID PARAM-NAME="PARAM-VALUE" ...][SD-ID ...]
+func parseStructuredData(data []byte) ([]sdElement, []byte) {
+	var elements []sdElement
+	for len(data) > 0 && data[0] == '[' {
+		element, rest, ok := parseSDElement(data[1:])
+		if !ok {
+			break
+		}
+		elements = append(elements, element)
+		data = rest
+	}
+	return elements, data
+}
+
+func parseSDElement(data []byte) (sdElement, []byte, bool) {
+	var element sdElement
+	end := bytes.IndexAny(data, " ]")
+	if end < 1 {
+		return element, nil, false
+	}
+	element.id = string(data[:end])
+	data = data[end:]
+
+	for len(data) > 0 && data[0] == ' ' {
+		data = data[1:]
+		end := bytes.IndexByte(data, '=')
+		if end < 1 || end+1 >= len(data) || data[end+1] != '"' {
+			return element, nil, false
+		}
+		param := sdParam{name: string(data[:end])}
+		data = data[end+2:]
+
+		var value []byte
+		i := 0
+		for ; i < len(data) && data[i] != '"'; i++ {
+			if data[i] == '\\' && i+1 < len(data) {
+				switch data[i+1] {
+				case '"', '\\', ']':
+					i++
+				}
+			}
+			value = append(value, data[i])
+		}
+		if i == len(data) {
+			return element, nil, false
+		}
+		param.value = string(value)
+		element.params = append(element.params, param)
+		data = data[i+1:]
+	}
+
+	if len(data) == 0 || data[0] != ']' {
+		return element, nil, false
+	}
+	return element, data[1:], true
+}
+
+// parseRFC3164 parses everything after the priority:
+//  [TIMESTAMP [HOSTNAME] ][TAG[[PID]]: ]MSG
+// As the RFC 3164 format is only loosely defined, the hostname and tag are only recognized if they look like them.
+func parseRFC3164(msg *message, data []byte) {
+	t, rest, hasTime := parseStamp(data)
+	if hasTime {
+		msg.time = t
+		data = rest
+	} else {
+		msg.time = time.Now()
+	}
+
+	if appName, procID, rest, ok := parseTag(data); ok {
+		msg.appName, msg.procID, data = appName, procID, rest
+	} else if hasTime {
+		// the hostname is only expected after a timestamp
+		hostname, afterHostname := nextWord(data)
+		if appName, procID, rest, ok := parseTag(afterHostname); ok && len(hostname) > 0 {
+			msg.hostname, msg.appName, msg.procID, data = string(hostname), appName, procID, rest
+		}
+	}
+	msg.text = data
+}
+
+// parseStamp parses the BSD syslog timestamp, with optional fractional seconds, and the following space:
+//  Jan  2 15:04:05.000
+// As it has no year, the current year is assumed, unless that would put the time more than a day in the future, in which case the message is from last year.
+func parseStamp(data []byte) (time.Time, []byte, bool) {
+	if len(data) < len(time.Stamp) {
+		return time.Time{}, data, false
+	}
+	t, err := time.ParseInLocation(time.Stamp, string(data[:len(time.Stamp)]), time.Local)
+	if err != nil {
+		return time.Time{}, data, false
+	}
+	data = data[len(time.Stamp):]
+
+	if len(data) > 1 && data[0] == '.' {
+		nanos, scale := 0, int(time.Second)
+		i := 1
+		for ; i < len(data) && data[i] >= '0' && data[i] <= '9'; i++ {
+			if scale > 1 {
+				scale /= 10
+				nanos += int(data[i]-'0') * scale
+			}
+		}
+		t = t.Add(time.Duration(nanos))
+		data = data[i:]
+	}
+	if len(data) > 0 {
+		if data[0] != ' ' {
+			return time.Time{}, data, false
+		}
+		data = data[1:]
+	}
+
+	now := time.Now()
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.Sub(now) > 24*time.Hour {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, data, true
+}
+
+// parseTag parses the tag, optionally followed by the pid in brackets, and then a colon:
+//  myapp[1234]: message
+func parseTag(data []byte) (string, string, []byte, bool) {
+	end := bytes.IndexAny(data, " :[")
+	if end < 1 {
+		return "", "", data, false
+	}
+	tag := string(data[:end])
+	rest := data[end:]
+
+	var procID string
+	if rest[0] == '[' {
+		pidEnd := bytes.IndexByte(rest, ']')
+		if pidEnd < 2 {
+			return "", "", data, false
+		}
+		procID = string(rest[1:pidEnd])
+		rest = rest[pidEnd+1:]
+	}
+
+	if len(rest) == 0 || rest[0] != ':' {
+		return "", "", data, false
+	}
+	rest = rest[1:]
+	if len(rest) > 0 {
+		if rest[0] != ' ' {
+			return "", "", data, false
+		}
+		rest = rest[1:]
+	}
+	return tag, procID, rest, true
+}
+
+// nextWord returns the data up to the next space, and the data after the space.
+func nextWord(data []byte) ([]byte, []byte) {
+	end := bytes.IndexByte(data, ' ')
+	if end == -1 {
+		return data, nil
+	}
+	return data[:end], data[end+1:]
+}
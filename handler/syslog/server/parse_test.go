@@ -0,0 +1,109 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+func TestParse_rfc5424(t *testing.T) {
+	logEvent := Parse([]byte(`<28>1 2016-01-02T03:04:05.006007-05:00 myhost myapp 1234 request [sawmill@32473 user.id="1234" escape="a\"b\\c\]d"][origin@123 ip="10.0.0.1"] a message`+"\n"), "sawmill@32473")
+
+	assert.Equal(t, event.Warning, logEvent.Level)
+	assert.Equal(t, "a message", logEvent.Message)
+	assert.True(t, time.Date(2016, 1, 2, 8, 4, 5, 6007000, time.UTC).Equal(logEvent.Time), logEvent.Time.String())
+	assert.Equal(t, map[string]interface{}{
+		"user.id":         "1234",
+		"escape":          `a"b\c]d`,
+		"origin@123.ip":   "10.0.0.1",
+		"syslog.facility": "daemon",
+		"syslog.hostname": "myhost",
+		"syslog.app_name": "myapp",
+		"syslog.proc_id":  "1234",
+		"syslog.msg_id":   "request",
+	}, logEvent.FlatFields)
+}
+
+func TestParse_rfc5424_nil(t *testing.T) {
+	before := time.Now()
+	logEvent := Parse([]byte("<30>1 - - - - - -"), "sawmill@32473")
+
+	assert.Equal(t, event.Info, logEvent.Level)
+	assert.Equal(t, "", logEvent.Message)
+	assert.False(t, logEvent.Time.Before(before))
+	assert.Equal(t, map[string]interface{}{"syslog.facility": "daemon"}, logEvent.FlatFields)
+
+	logEvent = Parse([]byte("<30>1 - - - - - - \xEF\xBB\xBFmsg"), "")
+	assert.Equal(t, "msg", logEvent.Message)
+}
+
+func TestParse_rfc5424_badStructuredData(t *testing.T) {
+	logEvent := Parse([]byte(`<30>1 - - - - - [ok a="1"][bad a=1] msg`), "")
+	assert.Equal(t, `[bad a=1] msg`, logEvent.Message)
+	assert.Equal(t, "1", logEvent.FlatFields["ok.a"])
+}
+
+func TestParse_rfc3164(t *testing.T) {
+	now := time.Now()
+	stamp := now.Format(time.StampMilli)
+
+	tests := []struct {
+		input    string
+		message  string
+		hostname string
+		appName  string
+		procID   string
+	}{
+		{"<28>" + stamp + " myapp[1234]: a message", "a message", "", "myapp", "1234"},
+		{"<28>" + stamp + " myhost myapp[1234]: a message", "a message", "myhost", "myapp", "1234"},
+		{"<28>" + stamp + " myhost myapp: a message", "a message", "myhost", "myapp", ""},
+		{"<28>" + stamp + " myapp:", "", "", "myapp", ""},
+		{"<28>" + stamp + " just a message", "just a message", "", "", ""},
+		{"<28>myapp[1]: no timestamp", "no timestamp", "", "myapp", "1"},
+		{"<28>no timestamp or tag", "no timestamp or tag", "", "", ""},
+	}
+	for _, test := range tests {
+		logEvent := Parse([]byte(test.input), "")
+		assert.Equal(t, event.Warning, logEvent.Level, test.input)
+		assert.Equal(t, test.message, logEvent.Message, test.input)
+		assert.Equal(t, test.hostname, stringField(logEvent, "syslog.hostname"), test.input)
+		assert.Equal(t, test.appName, stringField(logEvent, "syslog.app_name"), test.input)
+		assert.Equal(t, test.procID, stringField(logEvent, "syslog.proc_id"), test.input)
+		assert.Equal(t, "daemon", logEvent.FlatFields["syslog.facility"], test.input)
+	}
+
+	logEvent := Parse([]byte("<28>"+stamp+" myapp: msg"), "")
+	assert.Equal(t, now.Truncate(time.Millisecond).Format(time.RFC3339Nano), logEvent.Time.Format(time.RFC3339Nano))
+}
+
+func TestParse_noPriority(t *testing.T) {
+	logEvent := Parse([]byte("hello <world>"), "")
+	assert.Equal(t, event.Notice, logEvent.Level)
+	assert.Equal(t, "hello <world>", logEvent.Message)
+	assert.Equal(t, "user", logEvent.FlatFields["syslog.facility"])
+
+	logEvent = Parse([]byte("<999>hello"), "")
+	assert.Equal(t, "<999>hello", logEvent.Message)
+}
+
+func TestParseStamp_lastYear(t *testing.T) {
+	now := time.Now()
+	future := now.Add(48 * time.Hour)
+	parsed, rest, ok := parseStamp([]byte(future.Format(time.Stamp) + " msg"))
+	assert.True(t, ok)
+	assert.Equal(t, "msg", string(rest))
+	assert.Equal(t, future.Year()-1, parsed.Year())
+
+	parsed, _, ok = parseStamp([]byte(now.Format(time.Stamp) + ".123456789"))
+	assert.True(t, ok)
+	assert.Equal(t, 123456789, parsed.Nanosecond())
+	assert.Equal(t, now.Year(), parsed.Year())
+}
+
+func stringField(logEvent *event.Event, key string) string {
+	value, _ := logEvent.FlatFields[key].(string)
+	return value
+}
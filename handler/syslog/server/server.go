@@ -0,0 +1,307 @@
+/*
+The server package receives syslog messages, and passes them as events to a sawmill handler.
+
+It listens on UDP, TCP and unix sockets, and accepts both the RFC 3164 and RFC 5424 formats, with either framing on stream sockets (RFC 6587). See Parse() for how messages become events.
+
+This can be used to relay syslog from devices which can't do anything else into sawmill handlers such as splunk:
+
+ s, err := splunk.New(splunkURL)
+ ...
+ srv := server.New(s)
+ if _, err := srv.Listen("udp", ":514"); err != nil {
+ 	...
+ }
+
+It is also useful for testing code which sends syslog.
+*/
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/phemmer/sawmill/event"
+	"github.com/phemmer/sawmill/handler/syslog"
+)
+
+// DefaultMaxMessageSize is the default of Server.MaxMessageSize.
+const DefaultMaxMessageSize = 65536
+
+// Handler represents a destination for the received events.
+//
+// This is the same as sawmill.Handler. Sawmill is not imported, as the server has no need for a logger.
+type Handler interface {
+	Event(event *event.Event) error
+}
+
+// Server receives syslog messages on any number of sockets, and passes them to its handler.
+type Server struct {
+	// StructuredDataID is the SD-ID whose parameters are placed directly in the event's fields. See Parse().
+	// Defaults to syslog.DefaultStructuredDataID, so that events sent by a syslog.SyslogHandler are received with their original fields.
+	StructuredDataID string
+
+	// MaxMessageSize is the largest message accepted. Longer datagrams and lines are truncated. Stream connections sending a longer octet-counted message are closed.
+	// Defaults to DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// OnError is called with errors from receiving messages, and from the handler.
+	// Defaults to printing the error on STDERR.
+	OnError func(error)
+
+	handler Handler
+	// handlerMutex serializes the calls to the handler, as messages are received in parallel
+	handlerMutex sync.Mutex
+	eventID      uint64
+
+	mutex   sync.Mutex
+	closed  bool
+	closers map[io.Closer]struct{}
+	// socketPaths are the unixgram sockets to remove on Close(). Stream sockets are removed by net.UnixListener.
+	socketPaths []string
+	wg          sync.WaitGroup
+}
+
+// New creates a server which passes the received messages to the given handler.
+// The server does not receive anything until Listen() or Accept() is called.
+func New(handler Handler) *Server {
+	return &Server{
+		StructuredDataID: syslog.DefaultStructuredDataID,
+		MaxMessageSize:   DefaultMaxMessageSize,
+		OnError:          func(err error) { fmt.Fprintf(os.Stderr, "sawmill: syslog server: %s\n", err) },
+		handler:          handler,
+		closers:          map[io.Closer]struct{}{},
+	}
+}
+
+// Listen starts receiving messages on the given network & address, as defined by the net package.
+// network may be "udp", "udp4", "udp6", "unixgram", "tcp", "tcp4", "tcp6", or "unix".
+//
+// The return value is the address listened on. This is useful when the address is ":0".
+func (server *Server) Listen(network string, addr string) (net.Addr, error) {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		conn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if !server.track(conn) {
+			conn.Close()
+			return nil, errors.New("server is closed")
+		}
+		if network == "unixgram" {
+			server.mutex.Lock()
+			server.socketPaths = append(server.socketPaths, addr)
+			server.mutex.Unlock()
+		}
+		server.wg.Add(1)
+		go server.servePacket(conn)
+		return conn.LocalAddr(), nil
+	case "tcp", "tcp4", "tcp6", "unix":
+		listener, err := net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := server.Accept(listener); err != nil {
+			return nil, err
+		}
+		return listener.Addr(), nil
+	}
+	return nil, fmt.Errorf("unsupported network %q", network)
+}
+
+// Accept starts receiving messages from the connections of the given listener. This allows for listeners not created by Listen(), such as with tls.NewListener().
+// The listener is closed by Close().
+func (server *Server) Accept(listener net.Listener) error {
+	if !server.track(listener) {
+		listener.Close()
+		return errors.New("server is closed")
+	}
+	server.wg.Add(1)
+	go server.accept(listener)
+	return nil
+}
+
+// Close stops receiving, closing all listeners and connections, and waits for any messages being handled.
+func (server *Server) Close() error {
+	server.mutex.Lock()
+	server.closed = true
+	var err error
+	for closer := range server.closers {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	for _, socketPath := range server.socketPaths {
+		os.Remove(socketPath)
+	}
+	server.socketPaths = nil
+	server.mutex.Unlock()
+
+	server.wg.Wait()
+	return err
+}
+
+// track adds the closer to be closed by Close(). It returns false if the server is already closed.
+func (server *Server) track(closer io.Closer) bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.closed {
+		return false
+	}
+	server.closers[closer] = struct{}{}
+	return true
+}
+
+func (server *Server) untrack(closer io.Closer) {
+	server.mutex.Lock()
+	delete(server.closers, closer)
+	server.mutex.Unlock()
+}
+
+func (server *Server) isClosed() bool {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.closed
+}
+
+// handle parses a message and passes it to the handler.
+func (server *Server) handle(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	logEvent := Parse(data, server.StructuredDataID)
+	logEvent.Id = atomic.AddUint64(&server.eventID, 1)
+
+	server.handlerMutex.Lock()
+	err := server.handler.Event(logEvent)
+	server.handlerMutex.Unlock()
+	if err != nil {
+		server.OnError(err)
+	}
+}
+
+// servePacket receives datagrams, each of which is a single message.
+func (server *Server) servePacket(conn net.PacketConn) {
+	defer server.wg.Done()
+	defer server.untrack(conn)
+
+	buf := make([]byte, server.MaxMessageSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !server.isClosed() {
+				server.OnError(err)
+			}
+			return
+		}
+		server.handle(buf[:n])
+	}
+}
+
+func (server *Server) accept(listener net.Listener) {
+	defer server.wg.Done()
+	defer server.untrack(listener)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !server.isClosed() {
+				server.OnError(err)
+			}
+			return
+		}
+		if !server.track(conn) {
+			conn.Close()
+			return
+		}
+		server.wg.Add(1)
+		go server.serveStream(conn)
+	}
+}
+
+// serveStream receives messages from a stream connection.
+// Each message may use either framing: octet-counted messages start with their length, and non-transparent framed messages start with "<" and end with a newline.
+func (server *Server) serveStream(conn net.Conn) {
+	defer server.wg.Done()
+	defer server.untrack(conn)
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			if err != io.EOF && !server.isClosed() {
+				server.OnError(err)
+			}
+			return
+		}
+
+		var data []byte
+		switch {
+		case first[0] == '\n':
+			reader.Discard(1)
+			continue
+		case first[0] >= '1' && first[0] <= '9':
+			data, err = server.readOctetCounted(reader)
+		default:
+			data, err = server.readLine(reader)
+		}
+		server.handle(data)
+		if err != nil {
+			if err != io.EOF && !server.isClosed() {
+				server.OnError(fmt.Errorf("%s: %s", conn.RemoteAddr(), err))
+			}
+			return
+		}
+	}
+}
+
+// readOctetCounted reads a message framed as:
+//  MSG-LEN SP SYSLOG-MSG
+func (server *Server) readOctetCounted(reader *bufio.Reader) ([]byte, error) {
+	length := 0
+	for digits := 0; ; digits++ {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == ' ' && digits > 0 {
+			break
+		}
+		if c < '0' || c > '9' || digits == 9 {
+			return nil, errors.New("invalid message length")
+		}
+		length = length*10 + int(c-'0')
+	}
+	if length > server.MaxMessageSize {
+		return nil, fmt.Errorf("message length %d exceeds the maximum of %d", length, server.MaxMessageSize)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readLine reads a newline terminated message, truncating it to MaxMessageSize. A message ended by EOF is returned along with io.EOF.
+func (server *Server) readLine(reader *bufio.Reader) ([]byte, error) {
+	var data []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if room := server.MaxMessageSize - len(data); room > 0 {
+			if len(chunk) > room {
+				chunk = chunk[:room]
+			}
+			data = append(data, chunk...)
+		}
+		if err != bufio.ErrBufferFull {
+			return data, err
+		}
+	}
+}
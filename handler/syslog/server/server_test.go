@@ -0,0 +1,184 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/phemmer/sawmill/event"
+	"github.com/phemmer/sawmill/handler/channel"
+	"github.com/phemmer/sawmill/handler/syslog"
+)
+
+func newServer(t *testing.T) (*Server, *channel.Handler) {
+	handler := channel.NewHandler()
+	server := New(handler)
+	server.OnError = func(err error) { t.Error(err) }
+	return server, handler
+}
+
+func tempSocket(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "sawmill-syslog-server")
+	require.NoError(t, err)
+	return filepath.Join(dir, "socket"), func() { os.RemoveAll(dir) }
+}
+
+// testRoundTrip sends an event through a SyslogHandler, and checks it is received with the same fields.
+func testRoundTrip(t *testing.T, handler *channel.Handler, protocol string, addr string, options ...syslog.Option) {
+	sender, err := syslog.New(protocol, addr, syslog.LOCAL3, "{{.Message}}", append(options, syslog.WithFormat(syslog.FormatRFC5424), syslog.WithTag("myapp"))...)
+	require.NoError(t, err)
+	defer sender.Close()
+
+	sent := event.New(1, event.Error, "a message", map[string]interface{}{"user": map[string]interface{}{"id": 1234}}, false)
+	require.NoError(t, sender.Event(sent))
+
+	received := handler.Next(time.Second)
+	require.NotNil(t, received)
+	assert.Equal(t, event.Error, received.Level)
+	assert.Equal(t, "a message", received.Message)
+	assert.True(t, sent.Time.Truncate(time.Microsecond).Equal(received.Time))
+	assert.Equal(t, "1234", received.FlatFields["user.id"])
+	assert.Equal(t, "local3", received.FlatFields["syslog.facility"])
+	assert.Equal(t, "myapp", received.FlatFields["syslog.app_name"])
+}
+
+func TestServer_udp(t *testing.T) {
+	server, handler := newServer(t)
+	defer server.Close()
+
+	addr, err := server.Listen("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testRoundTrip(t, handler, "udp", addr.String())
+}
+
+func TestServer_tcp(t *testing.T) {
+	server, handler := newServer(t)
+	defer server.Close()
+
+	addr, err := server.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	testRoundTrip(t, handler, "tcp", addr.String())
+	testRoundTrip(t, handler, "tcp", addr.String(), syslog.WithFraming(syslog.FramingOctetCounting))
+}
+
+func TestServer_unixgram(t *testing.T) {
+	socketPath, cleanup := tempSocket(t)
+	defer cleanup()
+
+	server, handler := newServer(t)
+	_, err := server.Listen("unixgram", socketPath)
+	require.NoError(t, err)
+	testRoundTrip(t, handler, "", socketPath)
+
+	require.NoError(t, server.Close())
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestServer_unix(t *testing.T) {
+	socketPath, cleanup := tempSocket(t)
+	defer cleanup()
+
+	server, handler := newServer(t)
+	defer server.Close()
+
+	_, err := server.Listen("unix", socketPath)
+	require.NoError(t, err)
+	testRoundTrip(t, handler, "", socketPath)
+}
+
+func TestServer_accept(t *testing.T) {
+	server, handler := newServer(t)
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, server.Accept(listener))
+
+	// mixed framing on a single connection, and a final message without a newline
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("<13>myapp: one\n\n10 <13>x: two<13>myapp: three"))
+	require.NoError(t, err)
+	conn.Close()
+
+	for _, message := range []string{"one", "two", "three"} {
+		received := handler.Next(time.Second)
+		require.NotNil(t, received)
+		assert.Equal(t, message, received.Message)
+	}
+}
+
+func TestServer_maxMessageSize(t *testing.T) {
+	server, handler := newServer(t)
+	defer server.Close()
+	server.MaxMessageSize = 12
+	errs := make(chan error, 1)
+	server.OnError = func(err error) { errs <- err }
+
+	addr, err := server.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", addr.String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("<13>a: truncated message\n13 <13>a: toolong"))
+	require.NoError(t, err)
+
+	received := handler.Next(time.Second)
+	require.NotNil(t, received)
+	assert.Equal(t, "trunc", received.Message)
+
+	select {
+	case err := <-errs:
+		assert.Contains(t, err.Error(), "exceeds the maximum")
+	case <-time.After(time.Second):
+		t.Error("no error for the message exceeding the maximum size")
+	}
+	assert.Nil(t, handler.Next(10*time.Millisecond))
+}
+
+type errorHandler struct{}
+
+func (errorHandler) Event(*event.Event) error { return errors.New("handler error") }
+
+func TestServer_handlerError(t *testing.T) {
+	server := New(errorHandler{})
+	defer server.Close()
+	errs := make(chan error, 1)
+	server.OnError = func(err error) { errs <- err }
+
+	addr, err := server.Listen("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	conn, err := net.Dial("udp", addr.String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("<13>msg"))
+	require.NoError(t, err)
+
+	select {
+	case err := <-errs:
+		assert.EqualError(t, err, "handler error")
+	case <-time.After(time.Second):
+		t.Error("handler error not reported")
+	}
+}
+
+func TestServer_closed(t *testing.T) {
+	server, _ := newServer(t)
+	require.NoError(t, server.Close())
+
+	_, err := server.Listen("tcp", "127.0.0.1:0")
+	assert.Error(t, err)
+	_, err = server.Listen("udp", "127.0.0.1:0")
+	assert.Error(t, err)
+	_, err = server.Listen("bogus", "")
+	assert.Error(t, err)
+}
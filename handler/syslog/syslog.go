@@ -5,12 +5,15 @@ package syslog
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"github.com/phemmer/sawmill/event"
 	"github.com/phemmer/sawmill/event/formatter"
 	"net"
 	"os"
 	"path"
+	"strconv"
+	"sync"
 	"text/template"
 	"time"
 )
@@ -43,6 +46,10 @@ const (
 	CRON
 	AUTHPRIV
 	FTP
+	_ // ntp
+	_ // security
+	_ // console
+	_ // clock
 	LOCAL0
 	LOCAL1
 	LOCAL2
@@ -71,19 +78,55 @@ type SyslogHandler struct {
 	syslogHostname   string
 	syslogFacility   facility
 	syslogTag        string
+	syslogProcID     string
 	Template         *template.Template
+
+	// Encoder, if set, is used to format events instead of Template. For example formatter.NewLogfmtEncoder().
+	Encoder formatter.Encoder
+
+	syslogFormat Format
+	sdID         string
+	msgID        string
+
+	includeHostname bool
+	facilityField   string
+	maxMessageSize  int
+	oversize        Oversize
+
+	framing      Framing
+	tlsConfig    *tls.Config
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	backoffMin   time.Duration
+	backoffMax   time.Duration
+	maxPending   int
+
+	// mutex protects the connection & reconnection state below
+	mutex sync.Mutex
+	// network is the network of the current connection, e.g. "unixgram" when the protocol was "unix"
+	network  string
+	backoff  time.Duration
+	nextDial time.Time
+	dialErr  error
+	// pending are the framed messages not yet sent, oldest first
+	pending [][]byte
+	dropped uint64
 }
 
 // New attempts to connect to syslog, and returns a new SyslogHandler if successful.
 //
 // protocol is a "network" as defined by the net package. Commonly either "unix" or "unixgram". See net.Dial for available values. Defaults to "unix" if emtpy.
 //
+// protocol may also be "tls", for TCP with TLS (RFC 5425). See WithTLSConfig().
+//
 // addr is the address where to reach the syslog daemon. Also see net.Dial. If empty, "/dev/log", "/var/run/syslog", and "/var/run/log" are tried.
 //
 // facility is the syslog facility to use for all events processed through this handler. Defaults to USER.
 //
 // templateString is the sawmill/event/formatter compatable template to use for formatting events. Defaults to formatter.SIMPLE_FORMAT.
-func New(protocol string, addr string, facility facility, templateString string) (*SyslogHandler, error) {
+//
+// options may be used to change the defaults, such as WithFormat(FormatRFC5424).
+func New(protocol string, addr string, facility facility, templateString string, options ...Option) (*SyslogHandler, error) {
 	tag := path.Base(os.Args[0])
 
 	if facility == 0 {
@@ -93,7 +136,7 @@ func New(protocol string, addr string, facility facility, templateString string)
 	if templateString == "" {
 		templateString = formatter.SIMPLE_FORMAT
 	}
-	formatterTemplate, err := template.New("").Parse(templateString)
+	formatterTemplate, err := formatter.NewTemplate("", templateString)
 	if err != nil {
 		fmt.Printf("Error parsing template: %s", err) //TODO send message somewhere else?
 		return nil, err
@@ -107,7 +150,17 @@ func New(protocol string, addr string, facility facility, templateString string)
 		syslogHostname: hostname,
 		syslogFacility: facility,
 		syslogTag:      tag,
+		syslogProcID:   strconv.Itoa(os.Getpid()),
 		Template:       formatterTemplate,
+		sdID:           DefaultStructuredDataID,
+		dialTimeout:    DefaultDialTimeout,
+		writeTimeout:   DefaultWriteTimeout,
+		backoffMin:     DefaultBackoffMin,
+		backoffMax:     DefaultBackoffMax,
+		maxPending:     DefaultBufferSize,
+	}
+	for _, option := range options {
+		option(sw)
 	}
 
 	err = sw.dial()
@@ -131,51 +184,92 @@ func (sw *SyslogHandler) dial() error {
 		}
 		for _, network := range logTypes {
 			for _, path := range logPaths {
-				conn, err := net.Dial(network, path)
+				conn, err := net.DialTimeout(network, path, sw.dialTimeout)
 				if err != nil {
 					continue
 				}
 				sw.syslogConnection = conn
+				sw.network = network
 				return nil
 			}
 		}
 		return fmt.Errorf("Could not find listening syslog daemon")
 	}
 
-	connection, err := net.Dial(sw.syslogProtocol, sw.syslogAddr)
+	var connection net.Conn
+	var err error
+	if sw.syslogProtocol == "tls" {
+		connection, err = tls.DialWithDialer(&net.Dialer{Timeout: sw.dialTimeout}, "tcp", sw.syslogAddr, sw.tlsConfig)
+	} else {
+		connection, err = net.DialTimeout(sw.syslogProtocol, sw.syslogAddr, sw.dialTimeout)
+	}
 	if err != nil {
 		return err
 	}
 	sw.syslogConnection = connection
+	sw.network = sw.syslogProtocol
 	return nil
 }
 
 // Event accepts an event and writes it out to the syslog daemon.
-// If the connection was lost, the function will attempt to reconnect once.
+// If the connection was lost, the function will attempt to reconnect. If that fails, the message is kept, and sent once a later event manages to reconnect. See WithReconnectBackoff() and WithBufferSize().
 func (sw *SyslogHandler) Event(logEvent *event.Event) error {
 	var templateBuffer bytes.Buffer
-	sw.Template.Execute(&templateBuffer, formatter.EventFormatter(logEvent))
+	if sw.Encoder != nil {
+		if err := sw.Encoder.Encode(&templateBuffer, logEvent); err != nil {
+			return err
+		}
+	} else {
+		sw.Template.Execute(&templateBuffer, formatter.EventFormatter(logEvent))
+	}
 	return sw.sendMessage(logEvent, templateBuffer.Bytes())
 }
 
 func (sw *SyslogHandler) sendMessage(event *event.Event, message []byte) error {
-	priority := int(sw.syslogFacility) | int(levelPriorityMap[event.Level])
-	timestamp := event.Time.Format(time.StampMilli) // this is the BSD syslog format. IETF syslog format is better, but is still relatively new.
-	tag := sw.syslogTag
-	pid := os.Getpid()
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
 
-	data := []byte(fmt.Sprintf("<%d>%s %s[%d]: %s\n", priority, timestamp, tag, pid, message))
+	header := sw.formatHeader(event, len(message) > 0, sw.maxHeaderSize(len(message)))
 
-	_, err := sw.syslogConnection.Write(data)
-	if err == nil { // write success
-		return nil
+	for _, data := range sw.fit(header, message) {
+		sw.pending = append(sw.pending, sw.frame(data))
+	}
+	err := sw.sendPending()
+	if overflow := len(sw.pending) - sw.maxPending; overflow > 0 {
+		// drop the oldest
+		for i := 0; i < overflow; i++ {
+			sw.pending[i] = nil
+		}
+		sw.pending = sw.pending[overflow:]
+		sw.dropped += uint64(overflow)
 	}
+	return err
+}
 
-	err = sw.dial()
-	if err != nil { // re-dial failed
-		return err
+// formatHeader returns the syslog header, according to the handler's format. It is everything before the message, including any separator.
+// maxLength is the size the header should be kept within, or 0 if unlimited. Only the RFC 5424 structured data can be shortened to do so.
+func (sw *SyslogHandler) formatHeader(event *event.Event, hasMessage bool, maxLength int) []byte {
+	priority := int(sw.eventFacility(event)) | int(levelPriorityMap[event.Level.Standard()])
+	if sw.syslogFormat == FormatRFC5424 {
+		return sw.formatRFC5424Header(priority, event, hasMessage, maxLength)
 	}
 
-	_, err = sw.syslogConnection.Write(data)
-	return err
+	var buf bytes.Buffer
+	buf.WriteByte('<')
+	buf.WriteString(strconv.Itoa(priority))
+	buf.WriteByte('>')
+	buf.WriteString(event.Time.Format(time.StampMilli)) // this is the BSD syslog format.
+	buf.WriteByte(' ')
+	if sw.includeHostname && sw.syslogHostname != "" {
+		buf.WriteString(sw.syslogHostname)
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(sw.syslogTag)
+	if sw.syslogProcID != "" {
+		buf.WriteByte('[')
+		buf.WriteString(sw.syslogProcID)
+		buf.WriteByte(']')
+	}
+	buf.WriteString(": ")
+	return buf.Bytes()
 }
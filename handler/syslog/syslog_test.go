@@ -16,6 +16,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/phemmer/sawmill/event"
+	"github.com/phemmer/sawmill/event/formatter"
 )
 
 type listener struct {
@@ -95,6 +96,13 @@ func (l *listener) serve(conn net.Conn, wg *sync.WaitGroup) {
 	}
 }
 
+func TestFacility_codes(t *testing.T) {
+	// the codes from RFC 5424, shifted into the priority
+	assert.Equal(t, facility(11<<3), FTP)
+	assert.Equal(t, facility(16<<3), LOCAL0)
+	assert.Equal(t, facility(23<<3), LOCAL7)
+}
+
 func TestNew(t *testing.T) {
 	l, err := newUNIXListener()
 	require.NoError(t, err)
@@ -150,3 +158,75 @@ func TestEvent_redial(t *testing.T) {
 	msg := <-l.MsgChan
 	assert.Equal(t, "<28>"+logEvent.Time.Format(time.StampMilli)+" syslog.test["+fmt.Sprintf("%d", os.Getpid())+"]: testing Event() -- test=TestEvent", msg)
 }
+
+func TestEvent_customLevel(t *testing.T) {
+	l, err := newUNIXListener()
+	require.NoError(t, err)
+	defer l.Close()
+
+	handler, err := New("", l.Addr, DAEMON, "")
+	require.NoError(t, err)
+
+	// unregistered levels are clamped to the nearest standard level
+	logEvent := event.New(1, event.Level(-1), "testing Event()", nil, false)
+	require.NoError(t, handler.Event(logEvent))
+	msg := <-l.MsgChan
+	assert.True(t, strings.HasPrefix(msg, "<31>"), msg)
+}
+
+func TestEvent_encoder(t *testing.T) {
+	l, err := newUNIXListener()
+	require.NoError(t, err)
+	defer l.Close()
+
+	handler, err := New("", l.Addr, DAEMON, "")
+	require.NoError(t, err)
+	handler.Encoder = formatter.NewLogfmtEncoder()
+
+	logEvent := event.New(1, event.Warning, "testing Event()", map[string]interface{}{"test": "TestEvent"}, false)
+	require.NoError(t, handler.Event(logEvent))
+
+	msg := <-l.MsgChan
+	assert.True(t, strings.HasSuffix(msg, `: time=`+logEvent.Time.Format(time.RFC3339Nano)+` level=warning msg="testing Event()" test=TestEvent`), msg)
+}
+
+func TestEvent_rfc5424(t *testing.T) {
+	l, err := newUNIXListener()
+	require.NoError(t, err)
+	defer l.Close()
+
+	handler, err := New("", l.Addr, DAEMON, "{{.Message}}", WithFormat(FormatRFC5424), WithMsgID("request"))
+	require.NoError(t, err)
+	handler.syslogHostname = "myhost"
+
+	logEvent := event.NewWithFields(1, event.Warning, "testing Event()", []event.Field{
+		{Key: "user", Value: map[string]interface{}{"id": 1234}},
+		{Key: "escape", Value: `a"b\c]d`},
+		{Key: "bad key=", Value: "x"},
+	}, false)
+	logEvent.Time = time.Date(2016, 1, 2, 3, 4, 5, 6007000, time.FixedZone("", -5*60*60))
+	require.NoError(t, handler.Event(logEvent))
+
+	msg := <-l.MsgChan
+	assert.Equal(t, fmt.Sprintf(`<28>1 2016-01-02T03:04:05.006007-05:00 myhost syslog.test %d request [sawmill@32473 user.id="1234" escape="a\"b\\c\]d" badkey="x"] testing Event()`, os.Getpid()), msg)
+}
+
+func TestEvent_rfc5424_nil(t *testing.T) {
+	l, err := newUNIXListener()
+	require.NoError(t, err)
+	defer l.Close()
+
+	handler, err := New("", l.Addr, DAEMON, "{{.Message}}", WithFormat(FormatRFC5424), WithStructuredDataID("custom@1"))
+	require.NoError(t, err)
+	handler.syslogHostname = ""
+
+	logEvent := event.New(1, event.Info, "", nil, false)
+	logEvent.Time = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, handler.Event(logEvent))
+	assert.Equal(t, fmt.Sprintf(`<30>1 2016-01-02T03:04:05.000000Z - syslog.test %d - -`, os.Getpid()), <-l.MsgChan)
+
+	logEvent = event.New(1, event.Info, "msg", map[string]interface{}{"a": 1}, false)
+	logEvent.Time = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, handler.Event(logEvent))
+	assert.Equal(t, fmt.Sprintf(`<30>1 2016-01-02T03:04:05.000000Z - syslog.test %d - [custom@1 a="1"] msg`, os.Getpid()), <-l.MsgChan)
+}
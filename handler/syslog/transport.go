@@ -0,0 +1,193 @@
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Framing is how messages are delimited on stream transports (RFC 6587).
+type Framing int
+
+const (
+	// FramingAuto uses FramingOctetCounting for the "tls" protocol, as required by RFC 5425, and FramingNonTransparent for everything else. This is the default.
+	FramingAuto Framing = iota
+	// FramingNonTransparent terminates each message with a newline. Messages containing newlines are split by the receiver.
+	FramingNonTransparent
+	// FramingOctetCounting prefixes each message with its length, allowing messages to contain newlines:
+	//  27 <28>Jan  2 03:04:05.000 ...
+	FramingOctetCounting
+)
+
+// Defaults for the transport options.
+const (
+	DefaultDialTimeout  = 10 * time.Second
+	DefaultWriteTimeout = 10 * time.Second
+	DefaultBackoffMin   = 100 * time.Millisecond
+	DefaultBackoffMax   = 30 * time.Second
+	DefaultBufferSize   = 1000
+)
+
+// WithTLSConfig sets the TLS configuration used with the "tls" protocol, such as the CA certificates of the collector, or a client certificate.
+// If not set, or the config has no ServerName, the host name from the address is verified.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(sw *SyslogHandler) {
+		sw.tlsConfig = config
+	}
+}
+
+// WithFraming sets how messages are delimited on stream transports. The default is FramingAuto.
+func WithFraming(framing Framing) Option {
+	return func(sw *SyslogHandler) {
+		sw.framing = framing
+	}
+}
+
+// WithDialTimeout sets the maximum time for connecting to the syslog daemon. The default is DefaultDialTimeout.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(sw *SyslogHandler) {
+		sw.dialTimeout = timeout
+	}
+}
+
+// WithWriteTimeout sets the maximum time for sending a message, after which the connection is considered broken and is reconnected. 0 disables the timeout. The default is DefaultWriteTimeout.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(sw *SyslogHandler) {
+		sw.writeTimeout = timeout
+	}
+}
+
+// WithReconnectBackoff sets how long to wait between attempts to reconnect. The wait starts at min, and doubles with each failed attempt up to max.
+// While waiting, events do not try to reconnect, and their messages are buffered. The defaults are DefaultBackoffMin and DefaultBackoffMax.
+func WithReconnectBackoff(min, max time.Duration) Option {
+	return func(sw *SyslogHandler) {
+		sw.backoffMin = min
+		sw.backoffMax = max
+	}
+}
+
+// WithBufferSize sets the number of messages kept while the connection is down. Once full, the oldest messages are dropped. 0 disables the buffer. The default is DefaultBufferSize.
+func WithBufferSize(messages int) Option {
+	return func(sw *SyslogHandler) {
+		sw.maxPending = messages
+	}
+}
+
+// frame applies the framing to the message, which is newline terminated.
+func (sw *SyslogHandler) frame(data []byte) []byte {
+	framing := sw.framing
+	if framing == FramingAuto {
+		framing = FramingNonTransparent
+		if sw.syslogProtocol == "tls" {
+			framing = FramingOctetCounting
+		}
+	}
+	if framing != FramingOctetCounting {
+		return data
+	}
+
+	if len(data) > 0 && data[len(data)-1] == '\n' {
+		data = data[:len(data)-1]
+	}
+	framed := make([]byte, 0, len(data)+8)
+	framed = strconv.AppendInt(framed, int64(len(data)), 10)
+	framed = append(framed, ' ')
+	return append(framed, data...)
+}
+
+// sendPending sends the buffered messages, oldest first, reconnecting as needed.
+// A failed write is retried once on a new connection, as the connection may have simply been closed by the daemon while idle.
+// A message which fails on the new connection too is dropped, as it is likely one which can never be sent, such as a datagram too large for the socket. Keeping it would block the messages behind it.
+// sw.mutex must be held.
+func (sw *SyslogHandler) sendPending() error {
+	var sendErr error
+	retried := false
+	for len(sw.pending) > 0 {
+		if sw.syslogConnection == nil {
+			if err := sw.reconnect(); err != nil {
+				return err
+			}
+		}
+		if err := sw.write(sw.pending[0]); err != nil {
+			sw.syslogConnection.Close()
+			sw.syslogConnection = nil
+			if !retried {
+				retried = true
+				continue
+			}
+			sendErr = err
+			sw.dropped++
+		}
+		retried = false
+		sw.pending[0] = nil
+		sw.pending = sw.pending[1:]
+	}
+	return sendErr
+}
+
+// reconnect dials the syslog daemon, unless still waiting for the backoff from the previous failure.
+func (sw *SyslogHandler) reconnect() error {
+	now := time.Now()
+	if now.Before(sw.nextDial) {
+		return fmt.Errorf("not connected, retrying in %s: %s", sw.nextDial.Sub(now), sw.dialErr)
+	}
+
+	if err := sw.dial(); err != nil {
+		sw.syslogConnection = nil
+		if sw.backoff == 0 {
+			sw.backoff = sw.backoffMin
+		} else if sw.backoff *= 2; sw.backoff > sw.backoffMax {
+			sw.backoff = sw.backoffMax
+		}
+		sw.nextDial = now.Add(sw.backoff)
+		sw.dialErr = err
+		return err
+	}
+	sw.backoff = 0
+	sw.nextDial = time.Time{}
+	sw.dialErr = nil
+	return nil
+}
+
+func (sw *SyslogHandler) write(data []byte) error {
+	if sw.writeTimeout > 0 {
+		sw.syslogConnection.SetWriteDeadline(time.Now().Add(sw.writeTimeout))
+	}
+	_, err := sw.syslogConnection.Write(data)
+	return err
+}
+
+// Flush tries to send any messages buffered while the connection was down. It is called by the logger when the handler is removed, such as by sawmill.Stop().
+func (sw *SyslogHandler) Flush() error {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	return sw.sendPending()
+}
+
+// Pending returns the number of messages buffered while the connection is down.
+func (sw *SyslogHandler) Pending() int {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	return len(sw.pending)
+}
+
+// Dropped returns the number of messages dropped because the buffer was full, or because they failed to send even on a new connection.
+func (sw *SyslogHandler) Dropped() uint64 {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	return sw.dropped
+}
+
+// Close closes the connection to the syslog daemon. Any buffered messages are discarded.
+func (sw *SyslogHandler) Close() error {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+	sw.pending = nil
+	if sw.syslogConnection == nil {
+		return nil
+	}
+	err := sw.syslogConnection.Close()
+	sw.syslogConnection = nil
+	return err
+}
@@ -0,0 +1,211 @@
+package syslog
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	mathrand "math/rand"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// selfSignedCert generates a certificate for 127.0.0.1.
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// readOctetCounted reads a single RFC 6587 octet counted message.
+func readOctetCounted(reader *bufio.Reader) (string, error) {
+	lengthString, err := reader.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	length, err := strconv.Atoi(lengthString[:len(lengthString)-1])
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, length)
+	_, err = io.ReadFull(reader, msg)
+	return string(msg), err
+}
+
+func TestEvent_tls(t *testing.T) {
+	cert := selfSignedCert(t)
+	nl, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+	defer nl.Close()
+
+	msgChan := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := nl.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					msg, err := readOctetCounted(reader)
+					if err != nil {
+						return
+					}
+					msgChan <- msg
+				}
+			}()
+		}
+	}()
+
+	// the certificate is not trusted
+	_, err = New("tls", nl.Addr().String(), DAEMON, "")
+	assert.Error(t, err)
+
+	x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(x509Cert)
+	handler, err := New("tls", nl.Addr().String(), DAEMON, "{{.Message}}", WithTLSConfig(&tls.Config{RootCAs: roots}))
+	require.NoError(t, err)
+	defer handler.Close()
+
+	logEvent := event.New(1, event.Warning, "line 1\nline 2", nil, false)
+	require.NoError(t, handler.Event(logEvent))
+	assert.Equal(t, "<28>"+logEvent.Time.Format(time.StampMilli)+" syslog.test["+fmt.Sprintf("%d", os.Getpid())+"]: line 1\nline 2", <-msgChan)
+}
+
+func TestSyslogHandler_frame(t *testing.T) {
+	sw := &SyslogHandler{syslogProtocol: "tcp"}
+	assert.Equal(t, "msg\n", string(sw.frame([]byte("msg\n"))))
+
+	sw.framing = FramingOctetCounting
+	assert.Equal(t, "3 msg", string(sw.frame([]byte("msg\n"))))
+
+	sw = &SyslogHandler{syslogProtocol: "tls"}
+	assert.Equal(t, "3 msg", string(sw.frame([]byte("msg\n"))))
+	sw.framing = FramingNonTransparent
+	assert.Equal(t, "msg\n", string(sw.frame([]byte("msg\n"))))
+}
+
+func TestEvent_reconnect(t *testing.T) {
+	sockPath := path.Join(os.TempDir(), fmt.Sprintf("syslog-%d.sock", mathrand.Int()))
+	nl, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+
+	handler, err := New("unix", sockPath, DAEMON, "{{.Message}}", WithReconnectBackoff(time.Hour, 2*time.Hour))
+	require.NoError(t, err)
+	defer handler.Close()
+	conn, err := nl.Accept()
+	require.NoError(t, err)
+
+	// the daemon goes away
+	conn.Close()
+	nl.Close()
+
+	assert.Error(t, handler.Event(event.New(1, event.Info, "one", nil, false)))
+	assert.Equal(t, time.Hour, handler.backoff)
+	// waiting for the backoff, so no attempt is made to reconnect
+	assert.Error(t, handler.Event(event.New(2, event.Info, "two", nil, false)))
+	assert.Equal(t, 2, handler.Pending())
+
+	// the daemon comes back
+	nl, err = net.Listen("unix", sockPath)
+	require.NoError(t, err)
+	defer nl.Close()
+	msgChan := make(chan string, 10)
+	go func() {
+		conn, err := nl.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			msgChan <- scanner.Text()
+		}
+	}()
+
+	handler.mutex.Lock()
+	handler.nextDial = time.Time{}
+	handler.mutex.Unlock()
+
+	require.NoError(t, handler.Event(event.New(3, event.Info, "three", nil, false)))
+	assert.Equal(t, 0, handler.Pending())
+	assert.Equal(t, time.Duration(0), handler.backoff)
+	for _, expected := range []string{"one", "two", "three"} {
+		select {
+		case msg := <-msgChan:
+			assert.Contains(t, msg, ": "+expected)
+		case <-time.After(time.Second):
+			t.Fatalf("did not receive %q", expected)
+		}
+	}
+}
+
+func TestEvent_bufferSize(t *testing.T) {
+	sockPath := path.Join(os.TempDir(), fmt.Sprintf("syslog-%d.sock", mathrand.Int()))
+	nl, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+
+	handler, err := New("unix", sockPath, DAEMON, "{{.Message}}", WithBufferSize(2), WithReconnectBackoff(time.Hour, time.Hour))
+	require.NoError(t, err)
+	defer handler.Close()
+	conn, err := nl.Accept()
+	require.NoError(t, err)
+	conn.Close()
+	nl.Close()
+
+	for i := 0; i < 5; i++ {
+		handler.Event(event.New(uint64(i), event.Info, "msg", nil, false))
+	}
+	assert.Equal(t, 2, handler.Pending())
+	assert.Equal(t, uint64(3), handler.Dropped())
+}
+
+func TestEvent_unsendable(t *testing.T) {
+	conn := newUDPListener(t)
+	defer conn.Close()
+
+	// the maximum size is larger than a UDP datagram can be
+	handler, err := New("udp", conn.LocalAddr().String(), DAEMON, "{{.Message}}", WithMaxMessageSize(100000))
+	require.NoError(t, err)
+	defer handler.Close()
+
+	assert.Error(t, handler.Event(event.New(1, event.Info, strings.Repeat("x", 70000), nil, false)))
+	assert.Equal(t, 0, handler.Pending())
+	assert.Equal(t, uint64(1), handler.Dropped())
+
+	require.NoError(t, handler.Event(event.New(2, event.Info, "after", nil, false)))
+	assert.Contains(t, receiveDatagram(t, conn), ": after")
+}
@@ -0,0 +1,461 @@
+/*
+The transform package provides a way to alter events before they are sent to a handler.
+
+The transform handler sits in front of another handler. When the transform handler receives an event, it makes a copy of the event, runs the copy through all its transformations, and then relays the copy to the next handler in the chain. The original event is never modified, so other handlers receiving the same event are not affected.
+
+This allows each destination to have its own view of an event. For example, the password field can be redacted from events sent to an error reporting service, while still being visible in a local debug log.
+
+Field keys are in the same dot notation as event.FlatFields (e.g. "user.password"). Both the event's FlatFields and nested Fields are transformed.
+*/
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/phemmer/sawmill/event"
+)
+
+// Handler represents a destination for sawmill to send events to.
+//
+// This is copied from the base sawmill package. Sawmill is not imported so that the base package can import the transform package without a dependency cycle.
+type Handler interface {
+	Event(event *event.Event) error
+}
+
+// TransformFunc is the signature for a transformation used by the handler.
+// The function is passed a copy of the event, which it may modify freely.
+type TransformFunc func(*event.Event)
+
+// ValueFunc is the signature for a transformation applied to individual field values.
+// The function is passed the field key in dot notation, and the value. It returns the new value.
+type ValueFunc func(key string, value interface{}) interface{}
+
+// RedactedValue is the value used in place of redacted fields.
+const RedactedValue = event.RedactedValue
+
+// TruncatedSuffix is appended to values shortened by Truncate().
+const TruncatedSuffix = "..."
+
+type TransformHandler struct {
+	nextHandler    Handler
+	transformFuncs []TransformFunc
+}
+
+// New creates a new TransformHandler which relays events to the handler specified in `nextHandler`.
+//
+// If any transformFuncs are provided, they are used as the initial transformation list.
+func New(nextHandler Handler, transformFuncs ...TransformFunc) *TransformHandler {
+	return &TransformHandler{
+		nextHandler:    nextHandler,
+		transformFuncs: transformFuncs,
+	}
+}
+
+// Event copies the event, applies the transformations to the copy, and relays the copy to the next handler.
+func (transformHandler *TransformHandler) Event(logEvent *event.Event) error {
+	// the copy is built field by field, as the event may be pooled, and its reference count belongs to the original
+	logEventCopy := event.Event{
+		Id:      logEvent.Id,
+		Level:   logEvent.Level,
+		Time:    logEvent.Time,
+		Message: logEvent.Message,
+		Fields:  copyFields(logEvent.Fields),
+		// keys added or renamed by the transformations will be missing from the order, and end up sorted after the others
+		FieldOrder: append([]string(nil), logEvent.FieldOrder...),
+		Stack:      logEvent.Stack,
+		Caller:     logEvent.Caller,
+	}
+	logEventCopy.FlatFields = make(map[string]interface{}, len(logEvent.FlatFields))
+	for k, v := range logEvent.FlatFields {
+		logEventCopy.FlatFields[k] = v
+	}
+
+	for _, transformFunc := range transformHandler.transformFuncs {
+		transformFunc(&logEventCopy)
+	}
+	return transformHandler.nextHandler.Event(&logEventCopy)
+}
+
+// AcceptsLevel indicates whether the next handler accepts events of the given level.
+// If the next handler does not implement AcceptsLevel(), all levels are accepted.
+func (transformHandler *TransformHandler) AcceptsLevel(level event.Level) bool {
+	if levelAccepter, ok := transformHandler.nextHandler.(interface {
+		AcceptsLevel(event.Level) bool
+	}); ok {
+		return levelAccepter.AcceptsLevel(level)
+	}
+	return true
+}
+
+// Transform adds a transformation function to the handler.
+//
+// The function is passed a copy of the event, which it may modify.
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (transformHandler *TransformHandler) Transform(transformFuncs ...TransformFunc) *TransformHandler {
+	transformHandler.transformFuncs = append(transformHandler.transformFuncs, transformFuncs...)
+
+	return transformHandler
+}
+
+// Rename adds a canned transformation which moves the field at key `from` to key `to`.
+// Any fields nested under `from` are moved as well.
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (transformHandler *TransformHandler) Rename(from string, to string) *TransformHandler {
+	transformFunc := func(logEvent *event.Event) {
+		renamed := map[string]interface{}{}
+		for key, value := range logEvent.FlatFields {
+			if key != from && !strings.HasPrefix(key, from+".") {
+				continue
+			}
+			delete(logEvent.FlatFields, key)
+			renamed[to+key[len(from):]] = value
+		}
+		for key, value := range renamed {
+			logEvent.FlatFields[key] = value
+		}
+
+		if value, ok := getField(logEvent.Fields, from); ok {
+			deleteField(logEvent.Fields, from)
+			logEvent.Fields = setField(logEvent.Fields, to, value)
+		}
+	}
+
+	return transformHandler.Transform(transformFunc)
+}
+
+// Drop adds a canned transformation which removes the fields with the given keys.
+// Any fields nested under the keys are removed as well.
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (transformHandler *TransformHandler) Drop(keys ...string) *TransformHandler {
+	transformFunc := func(logEvent *event.Event) {
+		for key := range logEvent.FlatFields {
+			for _, dropKey := range keys {
+				if key == dropKey || strings.HasPrefix(key, dropKey+".") {
+					delete(logEvent.FlatFields, key)
+					break
+				}
+			}
+		}
+
+		for _, dropKey := range keys {
+			deleteField(logEvent.Fields, dropKey)
+		}
+	}
+
+	return transformHandler.Transform(transformFunc)
+}
+
+// Add adds a canned transformation which sets a static field on every event, such as the service name or environment.
+// If the event already has a field with the same key, it is replaced.
+//
+// The value should be a scalar (string, number, etc). It is not flattened.
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (transformHandler *TransformHandler) Add(key string, value interface{}) *TransformHandler {
+	transformFunc := func(logEvent *event.Event) {
+		logEvent.FlatFields[key] = value
+		logEvent.Fields = setField(logEvent.Fields, key, value)
+	}
+
+	return transformHandler.Transform(transformFunc)
+}
+
+// Values adds a transformation which passes every field value through valueFunc.
+//
+// The function is called for each entry in FlatFields, and each leaf value in Fields.
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (transformHandler *TransformHandler) Values(valueFunc ValueFunc) *TransformHandler {
+	transformFunc := func(logEvent *event.Event) {
+		for key, value := range logEvent.FlatFields {
+			logEvent.FlatFields[key] = valueFunc(key, value)
+		}
+		logEvent.Fields = mapFields(logEvent.Fields, "", func(key string, value interface{}) (interface{}, bool) {
+			if isContainer(value) {
+				return value, false
+			}
+			return valueFunc(key, value), true
+		})
+	}
+
+	return transformHandler.Transform(transformFunc)
+}
+
+// Redact adds a canned transformation which replaces the value of any field matching one of the patterns with RedactedValue.
+//
+// Patterns use the syntax of path.Match, and are compared case-insensitively against each dot separated component of the key, as well as the full key. Thus a pattern of "password" matches both "password" and "user.Password", and "*token*" matches "auth.access_token".
+// If a nested structure matches, the whole structure is redacted.
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (transformHandler *TransformHandler) Redact(patterns ...string) *TransformHandler {
+	return transformHandler.replaceMatching(patterns, func(value interface{}) interface{} {
+		return RedactedValue
+	})
+}
+
+// Hash adds a canned transformation which replaces the value of any field matching one of the patterns with a SHA-256 hash of the value.
+// This hides the value while still allowing events carrying the same value to be correlated.
+//
+// Patterns are matched the same as with Redact().
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (transformHandler *TransformHandler) Hash(patterns ...string) *TransformHandler {
+	return transformHandler.replaceMatching(patterns, func(value interface{}) interface{} {
+		var data []byte
+		switch value := value.(type) {
+		case string:
+			data = []byte(value)
+		case []byte:
+			data = value
+		default:
+			data = []byte(fmt.Sprintf("%v", value))
+		}
+		sum := sha256.Sum256(data)
+		return "sha256:" + hex.EncodeToString(sum[:])
+	})
+}
+
+func (transformHandler *TransformHandler) replaceMatching(patterns []string, replace func(interface{}) interface{}) *TransformHandler {
+	transformFunc := func(logEvent *event.Event) {
+		for key, value := range logEvent.FlatFields {
+			if keyMatch(key, patterns) {
+				logEvent.FlatFields[key] = replace(value)
+			}
+		}
+		logEvent.Fields = mapFields(logEvent.Fields, "", func(key string, value interface{}) (interface{}, bool) {
+			if keyMatch(key, patterns) {
+				return replace(value), true
+			}
+			return value, false
+		})
+	}
+
+	return transformHandler.Transform(transformFunc)
+}
+
+// Truncate adds a canned transformation which shortens any string or []byte field value longer than maxLength bytes.
+// Truncated values have TruncatedSuffix appended. A negative maxLength is treated as 0.
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (transformHandler *TransformHandler) Truncate(maxLength int) *TransformHandler {
+	if maxLength < 0 {
+		maxLength = 0
+	}
+	return transformHandler.Values(func(key string, value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			if len(v) > maxLength {
+				return truncateString(v, maxLength)
+			}
+		case []byte:
+			if len(v) > maxLength {
+				return truncateString(string(v), maxLength)
+			}
+		}
+		return value
+	})
+}
+
+// truncateString cuts str to at most maxLength bytes without splitting a multi-byte character, and appends TruncatedSuffix.
+func truncateString(str string, maxLength int) string {
+	for maxLength > 0 && !utf8.RuneStart(str[maxLength]) {
+		maxLength--
+	}
+	return str[:maxLength] + TruncatedSuffix
+}
+
+// keyMatch returns whether the full key, or any dot separated component of it, matches one of the patterns.
+func keyMatch(key string, patterns []string) bool {
+	key = strings.ToLower(key)
+	components := strings.Split(key, ".")
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if match, _ := path.Match(pattern, key); match {
+			return true
+		}
+		for _, component := range components {
+			if match, _ := path.Match(pattern, component); match {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// copyFields makes a copy of all the containers (maps & slices) in the fields produced by event.New(), so that they may be modified without affecting the original.
+// Leaf values are not copied, as transformations replace them rather than modify them.
+func copyFields(fields interface{}) interface{} {
+	return mapFields(fields, "", func(key string, value interface{}) (interface{}, bool) {
+		return value, false
+	})
+}
+
+// isContainer returns whether the value is one of the container types produced by event.New().
+func isContainer(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, *map[string]interface{}, map[interface{}]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+// mapFields recreates the fields structure, passing every value through mapFunc.
+// If mapFunc returns true, the returned value is used as is. Otherwise if the value is a container, its contents are recursively mapped.
+func mapFields(fields interface{}, key string, mapFunc func(string, interface{}) (interface{}, bool)) interface{} {
+	if key != "" {
+		if value, done := mapFunc(key, fields); done {
+			return value
+		}
+	}
+	return mapContainer(fields, key, mapFunc)
+}
+
+// mapContainer recreates the container, passing each of its entries through mapFields.
+// If fields is not a container, it is returned as is.
+func mapContainer(fields interface{}, key string, mapFunc func(string, interface{}) (interface{}, bool)) interface{} {
+	prefix := key
+	if prefix != "" {
+		prefix = prefix + "."
+	}
+
+	switch fields := fields.(type) {
+	case map[string]interface{}:
+		newFields := make(map[string]interface{}, len(fields))
+		for k, v := range fields {
+			newFields[k] = mapFields(v, prefix+k, mapFunc)
+		}
+		return newFields
+	case *map[string]interface{}:
+		if fields == nil {
+			return fields
+		}
+		newFields := mapContainer(*fields, key, mapFunc).(map[string]interface{})
+		return &newFields
+	case map[interface{}]interface{}:
+		newFields := make(map[interface{}]interface{}, len(fields))
+		for k, v := range fields {
+			newFields[k] = mapFields(v, prefix+fmt.Sprintf("%v", k), mapFunc)
+		}
+		return newFields
+	case []interface{}:
+		newFields := make([]interface{}, len(fields))
+		for i, v := range fields {
+			newFields[i] = mapFields(v, prefix+strconv.Itoa(i), mapFunc)
+		}
+		return newFields
+	}
+
+	return fields
+}
+
+// splitKey splits a dot notation key into the first component, and the remainder.
+func splitKey(key string) (string, string) {
+	if i := strings.IndexByte(key, '.'); i != -1 {
+		return key[:i], key[i+1:]
+	}
+	return key, ""
+}
+
+// getField retrieves the value at the given dot notation key from within the fields.
+func getField(fields interface{}, key string) (interface{}, bool) {
+	head, rest := splitKey(key)
+
+	var value interface{}
+	var ok bool
+	switch fields := fields.(type) {
+	case map[string]interface{}:
+		value, ok = fields[head]
+	case *map[string]interface{}:
+		if fields == nil {
+			return nil, false
+		}
+		return getField(*fields, key)
+	case map[interface{}]interface{}:
+		value, ok = fields[head]
+	case []interface{}:
+		i, err := strconv.Atoi(head)
+		if err != nil || i < 0 || i >= len(fields) {
+			return nil, false
+		}
+		value, ok = fields[i], true
+	}
+
+	if !ok || rest == "" {
+		return value, ok
+	}
+	return getField(value, rest)
+}
+
+// deleteField removes the value at the given dot notation key from within the fields.
+// Slice entries are set to nil rather than removed, so that the indices of the other entries do not change.
+func deleteField(fields interface{}, key string) {
+	head, rest := splitKey(key)
+
+	if rest != "" {
+		if value, ok := getField(fields, head); ok {
+			deleteField(value, rest)
+		}
+		return
+	}
+
+	switch fields := fields.(type) {
+	case map[string]interface{}:
+		delete(fields, head)
+	case *map[string]interface{}:
+		if fields != nil {
+			delete(*fields, head)
+		}
+	case map[interface{}]interface{}:
+		delete(fields, head)
+	case []interface{}:
+		if i, err := strconv.Atoi(head); err == nil && i >= 0 && i < len(fields) {
+			fields[i] = nil
+		}
+	}
+}
+
+// setField sets the value at the given dot notation key within the fields, creating intermediate maps as necessary.
+// As the fields may need to be created (e.g. the event had no fields), the resulting fields are returned.
+// If the fields are not a container (e.g. a plain string), they are returned unmodified.
+func setField(fields interface{}, key string, value interface{}) interface{} {
+	head, rest := splitKey(key)
+
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+
+	if rest != "" {
+		child, _ := getField(fields, head)
+		if child != nil && !isContainer(child) {
+			// can't nest under a scalar
+			return fields
+		}
+		value = setField(child, rest, value)
+	}
+
+	switch fields := fields.(type) {
+	case map[string]interface{}:
+		fields[head] = value
+	case *map[string]interface{}:
+		if fields != nil {
+			(*fields)[head] = value
+		}
+	case map[interface{}]interface{}:
+		fields[head] = value
+	case []interface{}:
+		if i, err := strconv.Atoi(head); err == nil && i >= 0 && i < len(fields) {
+			fields[i] = value
+		}
+	}
+
+	return fields
+}
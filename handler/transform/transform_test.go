@@ -0,0 +1,199 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/phemmer/sawmill/event"
+	"github.com/phemmer/sawmill/handler/capture"
+)
+
+func makeEvent() *event.Event {
+	data := map[string]interface{}{
+		"user": map[string]interface{}{
+			"name":     "alice",
+			"Password": "hunter2",
+		},
+		"token": "abc123",
+		"count": 3,
+	}
+
+	return event.New(1, event.Info, "testing", data, false)
+}
+
+func TestEvent(t *testing.T) {
+	ch := capture.NewHandler()
+	th := New(ch)
+
+	logEvent := makeEvent()
+	require.NoError(t, th.Event(logEvent))
+
+	require.Len(t, ch.Events(), 1)
+	assert.Equal(t, logEvent.FlatFields, ch.Last().FlatFields)
+	assert.Equal(t, logEvent.Fields, ch.Last().Fields)
+	// must be a copy
+	assert.False(t, logEvent == ch.Last())
+}
+
+func TestTransform(t *testing.T) {
+	ch := capture.NewHandler()
+	th := New(ch)
+	th.Transform(func(e *event.Event) { e.Message = "transformed" })
+
+	logEvent := makeEvent()
+	th.Event(logEvent)
+
+	assert.Equal(t, "transformed", ch.Last().Message)
+	assert.Equal(t, "testing", logEvent.Message)
+}
+
+func TestRename(t *testing.T) {
+	ch := capture.NewHandler()
+	th := New(ch).Rename("user", "account").Rename("count", "n")
+
+	logEvent := makeEvent()
+	th.Event(logEvent)
+
+	flatFields := ch.Last().FlatFields
+	assert.Equal(t, "alice", flatFields["account.name"])
+	assert.Equal(t, 3, flatFields["n"])
+	assert.NotContains(t, flatFields, "user.name")
+	assert.NotContains(t, flatFields, "count")
+
+	fields := ch.Last().Fields.(map[interface{}]interface{})
+	assert.Contains(t, fields, "account")
+	assert.NotContains(t, fields, "user")
+	assert.Equal(t, 3, fields["n"])
+
+	// original untouched
+	assert.Equal(t, "alice", logEvent.FlatFields["user.name"])
+	assert.Contains(t, logEvent.Fields.(map[interface{}]interface{}), "user")
+}
+
+func TestDrop(t *testing.T) {
+	ch := capture.NewHandler()
+	th := New(ch).Drop("user.Password", "token")
+
+	logEvent := makeEvent()
+	th.Event(logEvent)
+
+	flatFields := ch.Last().FlatFields
+	assert.NotContains(t, flatFields, "user.Password")
+	assert.NotContains(t, flatFields, "token")
+	assert.Equal(t, "alice", flatFields["user.name"])
+
+	fields := ch.Last().Fields.(map[interface{}]interface{})
+	assert.NotContains(t, fields, "token")
+	assert.NotContains(t, fields["user"], "Password")
+	assert.Contains(t, fields["user"], "name")
+
+	assert.Equal(t, "hunter2", logEvent.FlatFields["user.Password"])
+	assert.Contains(t, logEvent.Fields.(map[interface{}]interface{})["user"], "Password")
+}
+
+func TestAdd(t *testing.T) {
+	ch := capture.NewHandler()
+	th := New(ch).Add("service", "api").Add("deploy.env", "prod")
+
+	th.Event(makeEvent())
+	assert.Equal(t, "api", ch.Last().FlatFields["service"])
+	assert.Equal(t, "prod", ch.Last().FlatFields["deploy.env"])
+	fields := ch.Last().Fields.(map[interface{}]interface{})
+	assert.Equal(t, "api", fields["service"])
+	assert.Equal(t, map[string]interface{}{"env": "prod"}, fields["deploy"])
+
+	// event without fields
+	th.Event(event.New(2, event.Info, "no fields", nil, false))
+	assert.Equal(t, "api", ch.Last().FlatFields["service"])
+	assert.Equal(t, "api", ch.Last().Fields.(map[string]interface{})["service"])
+}
+
+func TestRedact(t *testing.T) {
+	ch := capture.NewHandler()
+	th := New(ch).Redact("password", "*token*")
+
+	logEvent := makeEvent()
+	th.Event(logEvent)
+
+	flatFields := ch.Last().FlatFields
+	assert.Equal(t, RedactedValue, flatFields["user.Password"])
+	assert.Equal(t, RedactedValue, flatFields["token"])
+	assert.Equal(t, "alice", flatFields["user.name"])
+
+	fields := ch.Last().Fields.(map[interface{}]interface{})
+	assert.Equal(t, RedactedValue, fields["token"])
+	assert.Equal(t, RedactedValue, fields["user"].(map[interface{}]interface{})["Password"])
+
+	assert.Equal(t, "hunter2", logEvent.FlatFields["user.Password"])
+	assert.Equal(t, "hunter2", logEvent.Fields.(map[interface{}]interface{})["user"].(map[interface{}]interface{})["Password"])
+}
+
+func TestRedact_struct(t *testing.T) {
+	ch := capture.NewHandler()
+	th := New(ch).Redact("credentials")
+
+	type config struct {
+		Host        string
+		Credentials struct{ User, Pass string }
+	}
+	c := &config{Host: "db"}
+	c.Credentials.User = "root"
+	c.Credentials.Pass = "toor"
+	th.Event(event.New(1, event.Info, "testing", c, false))
+
+	flatFields := ch.Last().FlatFields
+	assert.Equal(t, RedactedValue, flatFields["Credentials.User"])
+	assert.Equal(t, RedactedValue, flatFields["Credentials.Pass"])
+	assert.Equal(t, "db", flatFields["Host"])
+
+	fields := *ch.Last().Fields.(*map[string]interface{})
+	assert.Equal(t, RedactedValue, fields["Credentials"])
+	assert.Equal(t, "db", fields["Host"])
+}
+
+func TestHash(t *testing.T) {
+	ch := capture.NewHandler()
+	th := New(ch).Hash("token")
+
+	th.Event(makeEvent())
+	hash1 := ch.Last().FlatFields["token"].(string)
+	assert.True(t, strings.HasPrefix(hash1, "sha256:"))
+	assert.NotContains(t, hash1, "abc123")
+	assert.Equal(t, hash1, ch.Last().Fields.(map[interface{}]interface{})["token"])
+
+	th.Event(makeEvent())
+	assert.Equal(t, hash1, ch.Last().FlatFields["token"])
+}
+
+func TestTruncate(t *testing.T) {
+	ch := capture.NewHandler()
+	th := New(ch).Truncate(4)
+
+	data := map[string]interface{}{
+		"short": "abc",
+		"long":  "abcdefgh",
+		"multi": "aaaéé",
+		"int":   123456789,
+	}
+	th.Event(event.New(1, event.Info, "testing", data, false))
+
+	flatFields := ch.Last().FlatFields
+	assert.Equal(t, "abc", flatFields["short"])
+	assert.Equal(t, "abcd"+TruncatedSuffix, flatFields["long"])
+	assert.Equal(t, "aaa"+TruncatedSuffix, flatFields["multi"])
+	assert.Equal(t, 123456789, flatFields["int"])
+
+	fields := ch.Last().Fields.(map[interface{}]interface{})
+	assert.Equal(t, "abcd"+TruncatedSuffix, fields["long"])
+}
+
+func TestTruncate_negative(t *testing.T) {
+	ch := capture.NewHandler()
+	th := New(ch).Truncate(-1)
+
+	th.Event(event.New(1, event.Info, "testing", map[string]interface{}{"long": "abc"}, false))
+	assert.Equal(t, TruncatedSuffix, ch.Last().FlatFields["long"])
+}
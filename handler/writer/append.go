@@ -0,0 +1,256 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrNotReopenable is returned by WriterHandler.Reopen() when the handler's Output is not an *AppendFile.
+var ErrNotReopenable = errors.New("output is not a reopenable file")
+
+// AppendFile is an io.Writer which appends to the file at a path, and can reopen that path.
+// It is the Output of handlers created by Append(), and may also be given to the other constructors, e.g. NewJSON().
+//
+// When an external tool such as logrotate renames the file, writes keep going to the renamed file until it is reopened.
+// Reopening can be done explicitly with Reopen(), on a signal with ReopenOnSignal(), or automatically with Poll().
+type AppendFile struct {
+	path string
+	mode os.FileMode
+
+	mutex  sync.Mutex
+	file   *os.File
+	closed bool
+	// size is the expected size of the file, used to detect truncation
+	size int64
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// OpenAppendFile opens the file at the given path for appending, creating it with the given mode if necessary.
+// The same mode is used whenever the file is recreated by Reopen().
+func OpenAppendFile(path string, mode os.FileMode) (*AppendFile, error) {
+	appendFile := &AppendFile{
+		path: path,
+		mode: mode,
+		stop: make(chan struct{}),
+	}
+	if err := appendFile.Reopen(); err != nil {
+		return nil, err
+	}
+	return appendFile, nil
+}
+
+// Path returns the path of the file.
+func (appendFile *AppendFile) Path() string {
+	return appendFile.path
+}
+
+// Write fills the io.Writer interface.
+func (appendFile *AppendFile) Write(p []byte) (int, error) {
+	appendFile.mutex.Lock()
+	defer appendFile.mutex.Unlock()
+
+	if appendFile.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := appendFile.file.Write(p)
+	appendFile.size += int64(n)
+	return n, err
+}
+
+// Reopen closes the file and opens the path again, creating a new file if it was renamed or removed.
+// If the path cannot be opened, the current file is kept and the error returned.
+// After Close(), os.ErrClosed is returned.
+func (appendFile *AppendFile) Reopen() error {
+	if appendFile.isClosed() {
+		return os.ErrClosed
+	}
+	file, err := os.OpenFile(appendFile.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, appendFile.mode)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	appendFile.mutex.Lock()
+	if appendFile.closed {
+		// closed while the file was being opened
+		appendFile.mutex.Unlock()
+		file.Close()
+		return os.ErrClosed
+	}
+	oldFile := appendFile.file
+	appendFile.file = file
+	appendFile.size = stat.Size()
+	appendFile.mutex.Unlock()
+
+	if oldFile != nil {
+		oldFile.Close()
+	}
+	return nil
+}
+
+func (appendFile *AppendFile) isClosed() bool {
+	appendFile.mutex.Lock()
+	defer appendFile.mutex.Unlock()
+	return appendFile.closed
+}
+
+// changed reports whether the path no longer refers to the open file, or the file was truncated.
+func (appendFile *AppendFile) changed() bool {
+	appendFile.mutex.Lock()
+	defer appendFile.mutex.Unlock()
+
+	if appendFile.closed {
+		return false
+	}
+	pathStat, err := os.Stat(appendFile.path)
+	if err != nil {
+		return true
+	}
+	fileStat, err := appendFile.file.Stat()
+	if err != nil || !os.SameFile(pathStat, fileStat) {
+		return true
+	}
+	return pathStat.Size() < appendFile.size
+}
+
+// ReopenOnSignal reopens the file whenever one of the given signals is received. If no signals are given, SIGHUP is used, which is what logrotate's postrotate scripts conventionally send.
+// This continues until Close() is called.
+//
+// The return value is the file itself. This is to allow chaining multiple operations together.
+func (appendFile *AppendFile) ReopenOnSignal(signals ...os.Signal) *AppendFile {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, signals...)
+
+	appendFile.wg.Add(1)
+	go func() {
+		defer appendFile.wg.Done()
+		defer signal.Stop(signalChan)
+		for {
+			select {
+			case <-signalChan:
+				appendFile.reopen()
+			case <-appendFile.stop:
+				return
+			}
+		}
+	}()
+	return appendFile
+}
+
+// Poll checks the path at the given interval, and reopens the file if the path was renamed, removed, or replaced by another file, or if the file was truncated.
+// This continues until Close() is called.
+//
+// The return value is the file itself. This is to allow chaining multiple operations together.
+func (appendFile *AppendFile) Poll(interval time.Duration) *AppendFile {
+	appendFile.wg.Add(1)
+	go func() {
+		defer appendFile.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if appendFile.changed() {
+					appendFile.reopen()
+				}
+			case <-appendFile.stop:
+				return
+			}
+		}
+	}()
+	return appendFile
+}
+
+// reopen is Reopen() for the background goroutines, which have nobody to return the error to.
+func (appendFile *AppendFile) reopen() {
+	if err := appendFile.Reopen(); err != nil {
+		fmt.Fprintf(os.Stderr, "sawmill: error reopening %s: %s\n", appendFile.path, err)
+	}
+}
+
+// Close stops any signal handling or polling, and closes the file.
+// Any later Write() or Reopen() returns os.ErrClosed.
+func (appendFile *AppendFile) Close() error {
+	appendFile.stopOnce.Do(func() { close(appendFile.stop) })
+	appendFile.wg.Wait()
+
+	appendFile.mutex.Lock()
+	defer appendFile.mutex.Unlock()
+	if appendFile.closed {
+		return nil
+	}
+	appendFile.closed = true
+	err := appendFile.file.Close()
+	appendFile.file = nil
+	return err
+}
+
+// appendFile returns the handler's Output as an *AppendFile, if it is one.
+func (handler *WriterHandler) appendFile() *AppendFile {
+	appendFile, _ := handler.Output.(*AppendFile)
+	return appendFile
+}
+
+// Reopen reopens the file of a handler created by Append(). See AppendFile.Reopen().
+// ErrNotReopenable is returned if the handler's Output is not an *AppendFile.
+func (handler *WriterHandler) Reopen() error {
+	appendFile := handler.appendFile()
+	if appendFile == nil {
+		return ErrNotReopenable
+	}
+	return appendFile.Reopen()
+}
+
+// ReopenOnSignal reopens the file of a handler created by Append() whenever one of the given signals (default SIGHUP) is received. For example:
+//  h, err := writer.Append("/var/log/foo", 0600, "")
+//  ...
+//  h.ReopenOnSignal()
+//
+// It does nothing if the handler's Output is not an *AppendFile. See AppendFile.ReopenOnSignal().
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (handler *WriterHandler) ReopenOnSignal(signals ...os.Signal) *WriterHandler {
+	if appendFile := handler.appendFile(); appendFile != nil {
+		appendFile.ReopenOnSignal(signals...)
+	}
+	return handler
+}
+
+// PollFile reopens the file of a handler created by Append() when it is renamed, removed, or truncated, checking at the given interval.
+// It does nothing if the handler's Output is not an *AppendFile. See AppendFile.Poll().
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (handler *WriterHandler) PollFile(interval time.Duration) *WriterHandler {
+	if appendFile := handler.appendFile(); appendFile != nil {
+		appendFile.Poll(interval)
+	}
+	return handler
+}
+
+// Close stops any periodic flush and flushes the buffer (see SetBuffer()), then closes the file of a handler created by Append(), stopping any signal handling or polling.
+// Outputs other than an *AppendFile, such as os.Stdout, are left open.
+func (handler *WriterHandler) Close() error {
+	handler.stopFlusher()
+	err := handler.Flush()
+	if appendFile := handler.appendFile(); appendFile != nil {
+		if closeErr := appendFile.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
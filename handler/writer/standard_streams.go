@@ -12,34 +12,77 @@ type StandardStreamsHandler struct {
 }
 
 // NewStandardStreamsHandler is a convenience function for constructing a new handler which sends to STDOUT/STDERR.
-// If the output is sent to a TTY, the format is formatter.CONSOLE_COLOR_FORMAT. Otherwise it is formatter.CONSOLE_NOCOLOR_FORMAT. The only difference between the two are the use of color escape codes.
+// If the output supports color (see DetectColor()), the format is formatter.CONSOLE_COLOR_FORMAT. Otherwise it is formatter.CONSOLE_NOCOLOR_FORMAT. The only difference between the two are the use of color escape codes.
 func NewStandardStreamsHandler() *StandardStreamsHandler {
-	var stdoutFormat, stderrFormat string
-	if IsTerminal(os.Stdout) {
-		stdoutFormat = formatter.CONSOLE_COLOR_FORMAT
-	} else {
-		stdoutFormat = formatter.CONSOLE_NOCOLOR_FORMAT
-	}
-	if IsTerminal(os.Stderr) {
-		stderrFormat = formatter.CONSOLE_COLOR_FORMAT
-	} else {
-		stderrFormat = formatter.CONSOLE_NOCOLOR_FORMAT
-	}
-
 	handler := &StandardStreamsHandler{}
 
 	// Discard the errors in the following.
 	// The only possible issue is if the template has format errors, and we're using the default, which is hard-coded.
-	handler.stdoutWriter, _ = New(os.Stdout, stdoutFormat)
-	handler.stderrWriter, _ = New(os.Stderr, stderrFormat)
+	handler.stdoutWriter, _ = New(os.Stdout, formatter.CONSOLE_NOCOLOR_FORMAT)
+	handler.stderrWriter, _ = New(os.Stderr, formatter.CONSOLE_NOCOLOR_FORMAT)
+	setColor(handler.stdoutWriter, DetectColor(os.Stdout))
+	setColor(handler.stderrWriter, DetectColor(os.Stderr))
+
+	return handler
+}
 
+// setColor switches the writer between the color & nocolor console formats according to the color level.
+func setColor(writer *WriterHandler, colorLevel formatter.ColorLevel) {
+	format := formatter.CONSOLE_COLOR_FORMAT
+	if colorLevel == formatter.ColorNone {
+		format = formatter.CONSOLE_NOCOLOR_FORMAT
+	}
+	writer.Template, _ = formatter.NewTemplate("", format)
+	writer.ColorLevel = colorLevel
+}
+
+// SetColor overrides the detected color support of both STDOUT & STDERR. For example to keep color when piping into `less -R`:
+//  handler := writer.NewStandardStreamsHandler().SetColor(formatter.ColorBasic)
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (handler *StandardStreamsHandler) SetColor(colorLevel formatter.ColorLevel) *StandardStreamsHandler {
+	setColor(handler.stdoutWriter, colorLevel)
+	setColor(handler.stderrWriter, colorLevel)
+	return handler
+}
+
+// SetTheme sets the colors used for both STDOUT & STDERR.
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (handler *StandardStreamsHandler) SetTheme(theme *formatter.Theme) *StandardStreamsHandler {
+	handler.stdoutWriter.Theme = theme
+	handler.stderrWriter.Theme = theme
+	return handler
+}
+
+// SetEncoder sets the encoder used for both STDOUT & STDERR, in place of the console templates. For example:
+//  handler := writer.NewStandardStreamsHandler().SetEncoder(formatter.NewLogfmtEncoder())
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (handler *StandardStreamsHandler) SetEncoder(encoder formatter.Encoder) *StandardStreamsHandler {
+	handler.stdoutWriter.Encoder = encoder
+	handler.stderrWriter.Encoder = encoder
+	return handler
+}
+
+// SetPretty switches both STDOUT & STDERR to the multi-line development format of formatter.PrettyEncoder, keeping their color support and theme. For example:
+//  handler := writer.NewStandardStreamsHandler().SetPretty()
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (handler *StandardStreamsHandler) SetPretty() *StandardStreamsHandler {
+	for _, writer := range []*WriterHandler{handler.stdoutWriter, handler.stderrWriter} {
+		encoder := formatter.NewPrettyEncoder()
+		encoder.Theme = writer.Theme
+		encoder.ColorLevel = writer.ColorLevel
+		writer.Encoder = encoder
+	}
 	return handler
 }
 
 // Event accepts an event and sends it to the appropriate output stream based on the event's level.
 // If the level is warning or higher, it is sent to STDERR. Otherwise it is sent to STDOUT.
 func (handler *StandardStreamsHandler) Event(logEvent *event.Event) error {
-	if logEvent.Level >= event.Warning {
+	if logEvent.Level.Standard() >= event.Warning {
 		return handler.stderrWriter.Event(logEvent)
 	}
 	return handler.stdoutWriter.Event(logEvent)
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/phemmer/sawmill/event"
+	"github.com/phemmer/sawmill/event/formatter"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -65,3 +66,61 @@ func TestStandardStreamsHandler_Event(t *testing.T) {
 	assert.Contains(t, outbuf.String(), "TestStandardStreamsHandler_Event info")
 	assert.Contains(t, errbuf.String(), "TestStandardStreamsHandler_Event error")
 }
+
+func TestStandardStreamsHandler_SetEncoder(t *testing.T) {
+	encoder := formatter.NewLogfmtEncoder()
+	h := NewStandardStreamsHandler().SetEncoder(encoder)
+	assert.Equal(t, encoder, h.stdoutWriter.Encoder)
+	assert.Equal(t, encoder, h.stderrWriter.Encoder)
+}
+
+func TestDetectColor(t *testing.T) {
+	_, pipeW, err := os.Pipe()
+	require.NoError(t, err)
+	defer pipeW.Close()
+
+	for _, name := range []string{"FORCE_COLOR", "NO_COLOR"} {
+		if value, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, value)
+			os.Unsetenv(name)
+		}
+	}
+
+	// not a terminal
+	assert.Equal(t, formatter.ColorNone, DetectColor(pipeW))
+
+	os.Setenv("FORCE_COLOR", "1")
+	assert.Equal(t, formatter.ColorBasic, DetectColor(pipeW))
+	os.Setenv("FORCE_COLOR", "3")
+	assert.Equal(t, formatter.ColorTrue, DetectColor(pipeW))
+	os.Setenv("FORCE_COLOR", "0")
+	assert.Equal(t, formatter.ColorNone, DetectColor(pipeW))
+	os.Unsetenv("FORCE_COLOR")
+}
+
+func TestStandardStreamsHandler_SetColor(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	h := NewStandardStreamsHandler().SetColor(formatter.ColorBasic).SetTheme(&formatter.Theme{
+		Levels: [8]formatter.Color{event.Info: formatter.Green},
+	})
+	h.stdoutWriter.Output = buf
+
+	require.NoError(t, h.Event(event.New(0, event.Info, "msg", map[string]interface{}{"foo": "bar"}, false)))
+	assert.Contains(t, buf.String(), "\x1b[32minfo\x1b[0m>")
+	// the theme has no key color
+	assert.Contains(t, buf.String(), " foo=bar")
+
+	buf.Reset()
+	h.SetColor(formatter.ColorNone)
+	require.NoError(t, h.Event(event.New(0, event.Info, "msg", nil, false)))
+	assert.NotContains(t, buf.String(), "\x1b[")
+}
+
+func TestStandardStreamsHandler_SetPretty(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	h := NewStandardStreamsHandler().SetColor(formatter.ColorNone).SetPretty()
+	h.stdoutWriter.Output = buf
+
+	require.NoError(t, h.Event(event.New(0, event.Info, "msg", map[string]interface{}{"foo": "bar"}, false)))
+	assert.Contains(t, buf.String(), " INFO   msg\n    foo = bar\n")
+}
@@ -26,6 +26,14 @@ File appender
  logger.AddHandler("logfile", h)
 
  logger.Info("FOO!", sawmill.Fields{"bar": "baz"})
+
+JSON lines
+
+ logger := sawmill.NewLogger()
+ logger.AddHandler("stdout", writer.NewJSON(os.Stdout, formatter.JSONOptions{}))
+
+ # {"bar":"baz","level":"info","msg":"FOO!","ts":"2016-01-02T03:04:05.123456789Z"}
+ logger.Info("FOO!", sawmill.Fields{"bar": "baz"})
 */
 package writer
 
@@ -34,7 +42,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/phemmer/sawmill/event"
 	"github.com/phemmer/sawmill/event/formatter"
@@ -48,10 +60,63 @@ func IsTerminal(stream interface {
 	return terminal.IsTerminal(int(stream.Fd()))
 }
 
+// DetectColor determines the color support of the given stream (e.g. os.Stdout).
+//
+// Color is disabled if the stream is not a terminal, if TERM is "dumb", or if the NO_COLOR environment variable is set.
+// Otherwise 24-bit color is used when COLORTERM is "truecolor" or "24bit", 256 color when TERM contains "256color", and the basic 16 colors for anything else.
+//
+// The FORCE_COLOR environment variable overrides all of the above: "0" or "false" disables color, "2" selects 256 color, "3" selects 24-bit color, and any other value enables the basic colors. This is useful when piping into `less -R`.
+func DetectColor(stream interface {
+	Fd() uintptr
+}) formatter.ColorLevel {
+	if force, ok := os.LookupEnv("FORCE_COLOR"); ok {
+		switch force {
+		case "0", "false":
+			return formatter.ColorNone
+		case "2":
+			return formatter.Color256
+		case "3":
+			return formatter.ColorTrue
+		}
+		return formatter.ColorBasic
+	}
+
+	if os.Getenv("NO_COLOR") != "" || !IsTerminal(stream) {
+		return formatter.ColorNone
+	}
+	term := os.Getenv("TERM")
+	if term == "dumb" {
+		return formatter.ColorNone
+	}
+	if colorTerm := os.Getenv("COLORTERM"); colorTerm == "truecolor" || colorTerm == "24bit" {
+		return formatter.ColorTrue
+	}
+	if strings.Contains(term, "256color") {
+		return formatter.Color256
+	}
+	return formatter.ColorBasic
+}
+
 // WriterHandler is responsible for converting an event into text using a template, and then sending that text to an io.Writer.
+// If Encoder is set, it is used instead of the template.
+//
+// Theme and ColorLevel are passed to the formatter, and control the colors used by templates which use color (e.g. formatter.CONSOLE_COLOR_FORMAT).
+//
+// By default each event is written to Output as soon as it is received. See SetBuffer() for batching the writes.
 type WriterHandler struct {
-	Output   io.Writer
-	Template *template.Template
+	Output     io.Writer
+	Template   *template.Template
+	Encoder    formatter.Encoder
+	Theme      *formatter.Theme
+	ColorLevel formatter.ColorLevel
+
+	mutex      sync.Mutex
+	buffer     bytes.Buffer
+	bufferSize int
+	// flushErr is an error from a periodic flush, returned by the next call to Event() or Flush()
+	flushErr  error
+	flushStop chan struct{}
+	flushDone chan struct{}
 }
 
 // New constructs a new WriterHandler handler.
@@ -61,7 +126,7 @@ func New(output io.Writer, templateString string) (*WriterHandler, error) {
 	if templateString == "" {
 		templateString = formatter.SIMPLE_FORMAT
 	}
-	formatterTemplate, err := template.New("").Parse(templateString)
+	formatterTemplate, err := formatter.NewTemplate("", templateString)
 	if err != nil {
 		fmt.Printf("Error parsing template: %s", err) //TODO send message somewhere else?
 		return nil, err
@@ -73,26 +138,192 @@ func New(output io.Writer, templateString string) (*WriterHandler, error) {
 	return handler, nil
 }
 
+// NewJSON constructs a new WriterHandler which writes each event as a single line JSON object.
+// See formatter.JSONOptions for controlling the content of the object.
+func NewJSON(output io.Writer, options formatter.JSONOptions) *WriterHandler {
+	return &WriterHandler{
+		Output:  output,
+		Encoder: formatter.NewJSONEncoder(options),
+	}
+}
+
+// NewLogfmt constructs a new WriterHandler which writes each event as a logfmt line. See formatter.LogfmtEncoder.
+func NewLogfmt(output io.Writer) *WriterHandler {
+	return &WriterHandler{
+		Output:  output,
+		Encoder: formatter.NewLogfmtEncoder(),
+	}
+}
+
+// NewPretty constructs a new WriterHandler which writes each event in the multi-line development format of formatter.PrettyEncoder.
+// If output is a stream such as os.Stderr, color is enabled according to DetectColor().
+func NewPretty(output io.Writer) *WriterHandler {
+	encoder := formatter.NewPrettyEncoder()
+	if stream, ok := output.(interface {
+		Fd() uintptr
+	}); ok {
+		encoder.ColorLevel = DetectColor(stream)
+	}
+	return &WriterHandler{
+		Output:  output,
+		Encoder: encoder,
+	}
+}
+
 // Append constructs a new WriterHandler which appends to the file at the given
 // path, creating it if necessary.
 // templateString must be a template supported by the sawmill/event/formatter package.
 // If the templateString is empty, the WriterHandler will use sawmill/event/formatter.SIMPLE_FORMAT.
+//
+// The handler's Output is an *AppendFile. To follow rotation by an external tool such as logrotate, use Reopen(), ReopenOnSignal(), or PollFile().
 func Append(path string, mode os.FileMode, templateString string) (*WriterHandler, error) {
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, mode)
+	f, err := OpenAppendFile(path, mode)
 	if err != nil {
 		return nil, err
 	}
 
-	return New(f, templateString)
+	handler, err := New(f, templateString)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return handler, nil
 }
 
 // Event accepts an event, formats it, and writes it to the WriterHandler's Output.
+//
+// If the template or encoder fails, the event is still written, in logfmt with a "format_error" field describing the failure (see formatter.LogfmtEncoder), and the error is returned.
+// Errors writing to Output are also returned. When buffering, that includes errors from a periodic flush since the previous call.
 func (handler *WriterHandler) Event(logEvent *event.Event) error {
-	//handler.Output.Write([]byte(fmt.Sprintf("%#v\n", event)))
-	var templateBuffer bytes.Buffer
-	handler.Template.Execute(&templateBuffer, formatter.EventFormatter(logEvent))
-	templateBuffer.WriteByte('\n')
-	handler.Output.Write(templateBuffer.Bytes())
+	var eventBuffer bytes.Buffer
+	err := handler.encode(&eventBuffer, logEvent)
+	eventBuffer.WriteByte('\n')
+	if writeErr := handler.write(eventBuffer.Bytes()); err == nil {
+		err = writeErr
+	}
+	return err
+}
+
+// encode formats the event into buf, falling back to logfmt if the template or encoder fails.
+func (handler *WriterHandler) encode(buf *bytes.Buffer, logEvent *event.Event) error {
+	var err error
+	if handler.Encoder != nil {
+		err = handler.Encoder.Encode(buf, logEvent)
+	} else {
+		eventFormatter := formatter.EventFormatter(logEvent)
+		eventFormatter.Theme = handler.Theme
+		eventFormatter.ColorLevel = handler.ColorLevel
+		err = handler.Template.Execute(buf, eventFormatter)
+	}
+	if err == nil {
+		return nil
+	}
+
+	// don't write a half rendered line
+	buf.Reset()
+	formatter.NewLogfmtEncoder().Encode(buf, logEvent)
+	buf.WriteString(" format_error=")
+	buf.WriteString(strconv.Quote(err.Error()))
+	return err
+}
+
+func (handler *WriterHandler) write(p []byte) error {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+
+	err := handler.flushErr
+	handler.flushErr = nil
+
+	if handler.bufferSize <= 0 {
+		if _, writeErr := handler.Output.Write(p); writeErr != nil {
+			err = writeErr
+		}
+		return err
+	}
+
+	handler.buffer.Write(p)
+	if handler.buffer.Len() >= handler.bufferSize {
+		if flushErr := handler.flush(); flushErr != nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+// flush writes out the buffer. The buffer is discarded even if the write fails, so that a broken Output does not cause unbounded growth.
+// handler.mutex must be held.
+func (handler *WriterHandler) flush() error {
+	if handler.buffer.Len() == 0 {
+		return nil
+	}
+	_, err := handler.Output.Write(handler.buffer.Bytes())
+	handler.buffer.Reset()
+	return err
+}
+
+// Flush writes out any buffered events. It also returns any error from a periodic flush since the last call to Event() or Flush().
+func (handler *WriterHandler) Flush() error {
+	handler.mutex.Lock()
+	defer handler.mutex.Unlock()
+
+	err := handler.flush()
+	if err == nil {
+		err = handler.flushErr
+	}
+	handler.flushErr = nil
+	return err
+}
+
+// SetBuffer enables buffering of the output, so that multiple events are sent to Output in a single write.
+// The buffer is written out once it reaches size bytes, and, if flushInterval is not 0, every flushInterval.
+// A size of 0 or less disables buffering.
+//
+// The buffer is also flushed by Flush() and Close(), and when the handler is removed from the logger, including by sawmill.Stop(). Note that sawmill.Sync() does not flush the buffer.
+//
+// The return value is the handler itself. This is to allow chaining multiple operations together.
+func (handler *WriterHandler) SetBuffer(size int, flushInterval time.Duration) *WriterHandler {
+	handler.stopFlusher()
+
+	handler.mutex.Lock()
+	if err := handler.flush(); err != nil && handler.flushErr == nil {
+		handler.flushErr = err
+	}
+	handler.bufferSize = size
+	handler.mutex.Unlock()
 
-	return nil
+	if size > 0 && flushInterval > 0 {
+		handler.flushStop = make(chan struct{})
+		handler.flushDone = make(chan struct{})
+		go handler.flusher(flushInterval, handler.flushStop, handler.flushDone)
+	}
+	return handler
+}
+
+func (handler *WriterHandler) flusher(interval time.Duration, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			handler.mutex.Lock()
+			if err := handler.flush(); err != nil && handler.flushErr == nil {
+				handler.flushErr = err
+			}
+			handler.mutex.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// stopFlusher stops the periodic flush started by SetBuffer(), if any.
+func (handler *WriterHandler) stopFlusher() {
+	if handler.flushStop == nil {
+		return
+	}
+	close(handler.flushStop)
+	<-handler.flushDone
+	handler.flushStop = nil
+	handler.flushDone = nil
 }
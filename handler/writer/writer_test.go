@@ -1,12 +1,18 @@
 package writer
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/phemmer/sawmill/event"
+	"github.com/phemmer/sawmill/event/formatter"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -53,3 +59,346 @@ func TestAppend(t *testing.T) {
 	assert.Contains(t, string(buf), "TestAppend message 1")
 	assert.Contains(t, string(buf), "TestAppend message 2")
 }
+
+func TestWriterHandler_caller(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	wh, err := New(buf, "{{.Message}} {{.ShortCaller}} {{.Caller}}")
+	require.NoError(t, err)
+
+	e := event.New(0, event.Info, "msg", nil, false)
+	e.Caller = &event.StackFrame{File: "/src/foo/handler.go", Line: 42}
+	require.NoError(t, wh.Event(e))
+	assert.Equal(t, "msg handler.go:42 /src/foo/handler.go:42\n", buf.String())
+
+	buf.Reset()
+	e.Caller = nil
+	require.NoError(t, wh.Event(e))
+	assert.Equal(t, "msg  \n", buf.String())
+}
+
+func TestNewJSON(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	wh := NewJSON(buf, formatter.JSONOptions{})
+
+	e := event.New(0, event.Warning, "a <message>", map[string]interface{}{"foo": map[string]interface{}{"bar": "baz"}, "level": "x"}, false)
+	e.Time = time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC)
+	require.NoError(t, wh.Event(e))
+	assert.Equal(t, `{"foo":{"bar":"baz"},"level":"warning","msg":"a <message>","ts":"2016-01-02T03:04:05.000000006Z"}`+"\n", buf.String())
+}
+
+func TestNewJSON_unixTime(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	wh := NewJSON(buf, formatter.JSONOptions{TimeFormat: formatter.TimeFormatUnix})
+
+	e := event.New(0, event.Info, "msg", nil, false)
+	e.Time = time.Unix(1451703845, 6)
+	require.NoError(t, wh.Event(e))
+	assert.Contains(t, buf.String(), `"ts":1451703845.000000006`)
+
+	buf.Reset()
+	e.Time = time.Unix(0, -500000000)
+	require.NoError(t, wh.Event(e))
+	assert.Contains(t, buf.String(), `"ts":-0.500000000`)
+
+	buf.Reset()
+	e.Time = time.Unix(-2, 250000000)
+	require.NoError(t, wh.Event(e))
+	assert.Contains(t, buf.String(), `"ts":-1.750000000`)
+}
+
+func TestNewJSON_options(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	wh := NewJSON(buf, formatter.JSONOptions{
+		TimeKey:    "time",
+		LevelKey:   "severity",
+		MessageKey: "message",
+		TimeFormat: formatter.TimeFormatUnix,
+		FieldsKey:  "data",
+		FlatFields: true,
+		Stack:      true,
+		Caller:     true,
+	})
+
+	e := event.New(0, event.Info, "msg", map[string]interface{}{"foo": map[string]interface{}{"bar": 1}}, true)
+	e.Time = time.Unix(1451703845, 500000000)
+	e.Caller = &event.StackFrame{File: "/src/foo/handler.go", Line: 42}
+	require.NoError(t, wh.Event(e))
+
+	var obj map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &obj))
+	assert.Equal(t, 1451703845.5, obj["time"])
+	assert.Equal(t, "info", obj["severity"])
+	assert.Equal(t, "msg", obj["message"])
+	assert.Equal(t, map[string]interface{}{"foo.bar": float64(1)}, obj["data"])
+	assert.Equal(t, "handler.go:42", obj["caller"])
+	require.NotEmpty(t, obj["stack"])
+	assert.Contains(t, obj["stack"].([]interface{})[0], "file")
+}
+
+func TestNewJSON_nonMapFields(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	wh := NewJSON(buf, formatter.JSONOptions{})
+
+	require.NoError(t, wh.Event(event.New(0, event.Info, "msg", []string{"a", "b"}, false)))
+	var obj map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &obj))
+	assert.Equal(t, []interface{}{"a", "b"}, obj["fields"])
+
+	buf.Reset()
+	require.NoError(t, wh.Event(event.New(0, event.Info, "msg", nil, false)))
+	obj = nil
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &obj))
+	assert.NotContains(t, obj, "fields")
+	assert.Equal(t, "msg", obj["msg"])
+}
+
+func TestNewLogfmt(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	wh := NewLogfmt(buf)
+
+	e := event.New(0, event.Info, "a message", map[string]interface{}{"foo": "bar baz"}, false)
+	e.Time = time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC)
+	require.NoError(t, wh.Event(e))
+	assert.Equal(t, `time=2016-01-02T03:04:05.000000006Z level=info msg="a message" foo="bar baz"`+"\n", buf.String())
+}
+
+func TestWriterHandler_fieldOrder(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	wh, err := New(buf, "")
+	require.NoError(t, err)
+
+	e := event.NewWithFields(0, event.Info, "msg", []event.Field{
+		{Key: "method", Value: "GET"},
+		{Key: "path", Value: "/foo"},
+		{Key: "status", Value: 200},
+		{Key: "duration", Value: time.Second},
+	}, false)
+	// a field not in the order, such as one added by a transform
+	e.FlatFields["added"] = "x"
+	require.NoError(t, wh.Event(e))
+	assert.Equal(t, "msg -- method=GET path=/foo status=200 duration=1s added=x\n", buf.String())
+}
+
+func TestNewPretty(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	wh := NewPretty(buf)
+
+	e := event.New(0, event.Info, "a message", map[string]interface{}{"foo": map[string]interface{}{"bar": "baz"}}, false)
+	e.Time = time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC)
+	require.NoError(t, wh.Event(e))
+	assert.Equal(t, "03:04:05.000 INFO   a message\n    foo\n      bar = baz\n", buf.String())
+}
+
+func TestWriterHandler_Reopen(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	fp := filepath.Join(td, "TestReopen")
+	wh, err := Append(fp, 0640, "{{.Message}}")
+	require.NoError(t, err)
+	defer wh.Close()
+
+	require.NoError(t, wh.Event(event.New(0, event.Info, "one", nil, false)))
+	require.NoError(t, os.Rename(fp, fp+".1"))
+	require.NoError(t, wh.Event(event.New(0, event.Info, "two", nil, false)))
+	require.NoError(t, wh.Reopen())
+	require.NoError(t, wh.Event(event.New(0, event.Info, "three", nil, false)))
+
+	data, err := ioutil.ReadFile(fp + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "one\ntwo\n", string(data))
+	data, err = ioutil.ReadFile(fp)
+	require.NoError(t, err)
+	assert.Equal(t, "three\n", string(data))
+
+	// the original mode is kept
+	stat, err := os.Stat(fp)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), stat.Mode())
+
+	wh, err = New(bytes.NewBuffer(nil), "")
+	require.NoError(t, err)
+	assert.Equal(t, ErrNotReopenable, wh.Reopen())
+}
+
+func TestAppendFile_closed(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	fp := filepath.Join(td, "TestClosed")
+	appendFile, err := OpenAppendFile(fp, 0600)
+	require.NoError(t, err)
+	require.NoError(t, appendFile.Close())
+	require.NoError(t, os.Remove(fp))
+
+	assert.Equal(t, os.ErrClosed, appendFile.Reopen())
+	_, err = appendFile.Write([]byte("foo\n"))
+	assert.Equal(t, os.ErrClosed, err)
+	_, err = os.Stat(fp)
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, appendFile.Close())
+}
+
+func TestWriterHandler_ReopenOnSignal(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	fp := filepath.Join(td, "TestReopenOnSignal")
+	wh, err := Append(fp, 0600, "{{.Message}}")
+	require.NoError(t, err)
+	defer wh.Close()
+	wh.ReopenOnSignal(syscall.SIGUSR1)
+
+	require.NoError(t, os.Rename(fp, fp+".1"))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	waitFor(t, func() bool {
+		_, err := os.Stat(fp)
+		return err == nil
+	})
+}
+
+func TestWriterHandler_PollFile(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	fp := filepath.Join(td, "TestPollFile")
+	wh, err := Append(fp, 0600, "{{.Message}}")
+	require.NoError(t, err)
+	defer wh.Close()
+	wh.PollFile(time.Millisecond)
+	appendFile := wh.Output.(*AppendFile)
+
+	// renamed
+	require.NoError(t, os.Rename(fp, fp+".1"))
+	waitFor(t, func() bool {
+		_, err := os.Stat(fp)
+		return err == nil
+	})
+
+	// truncated
+	require.NoError(t, wh.Event(event.New(0, event.Info, "one", nil, false)))
+	require.NoError(t, os.Truncate(fp, 0))
+	waitFor(t, func() bool {
+		appendFile.mutex.Lock()
+		defer appendFile.mutex.Unlock()
+		return appendFile.size == 0
+	})
+	require.NoError(t, wh.Event(event.New(0, event.Info, "two", nil, false)))
+	data, err := ioutil.ReadFile(fp)
+	require.NoError(t, err)
+	assert.Equal(t, "two\n", string(data))
+}
+
+// waitFor waits up to a second for condition to become true.
+func waitFor(t *testing.T, condition func() bool) {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+	assert.Fail(t, "condition not met")
+}
+
+type failWriter struct{ err error }
+
+func (w failWriter) Write(p []byte) (int, error) { return 0, w.err }
+
+func TestWriterHandler_writeError(t *testing.T) {
+	writeErr := errors.New("disk full")
+	wh, err := New(failWriter{writeErr}, "")
+	require.NoError(t, err)
+
+	assert.Equal(t, writeErr, wh.Event(event.New(0, event.Info, "msg", nil, false)))
+}
+
+func TestWriterHandler_templateError(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	wh, err := New(buf, `partial {{.Event.Message}} {{call .Event.Fields}}`)
+	require.NoError(t, err)
+
+	e := event.New(0, event.Info, "a message", map[string]interface{}{"foo": "bar"}, false)
+	e.Time = time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC)
+	err = wh.Event(e)
+	require.Error(t, err)
+
+	// the partially rendered template is not written
+	assert.NotContains(t, buf.String(), "partial")
+	fields, parseErr := formatter.ParseLogfmt(buf.Bytes())
+	require.NoError(t, parseErr)
+	assert.Equal(t, []formatter.LogfmtField{
+		{Key: "time", Value: "2016-01-02T03:04:05.000000006Z"},
+		{Key: "level", Value: "info"},
+		{Key: "msg", Value: "a message"},
+		{Key: "foo", Value: "bar"},
+		{Key: "format_error", Value: err.Error()},
+	}, fields)
+}
+
+func TestWriterHandler_SetBuffer(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	wh, err := New(buf, "{{.Message}}")
+	require.NoError(t, err)
+	wh.SetBuffer(8, 0)
+
+	require.NoError(t, wh.Event(event.New(0, event.Info, "one", nil, false)))
+	assert.Equal(t, "", buf.String())
+	require.NoError(t, wh.Event(event.New(0, event.Info, "two", nil, false)))
+	assert.Equal(t, "one\ntwo\n", buf.String())
+
+	require.NoError(t, wh.Event(event.New(0, event.Info, "three", nil, false)))
+	assert.Equal(t, "one\ntwo\n", buf.String())
+	require.NoError(t, wh.Flush())
+	assert.Equal(t, "one\ntwo\nthree\n", buf.String())
+
+	// disabling the buffer flushes it
+	require.NoError(t, wh.Event(event.New(0, event.Info, "four", nil, false)))
+	wh.SetBuffer(0, 0)
+	assert.Equal(t, "one\ntwo\nthree\nfour\n", buf.String())
+}
+
+func TestWriterHandler_SetBuffer_interval(t *testing.T) {
+	td, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	fp := filepath.Join(td, "TestSetBuffer")
+	wh, err := Append(fp, 0600, "{{.Message}}")
+	require.NoError(t, err)
+	wh.SetBuffer(4096, time.Millisecond)
+
+	require.NoError(t, wh.Event(event.New(0, event.Info, "one", nil, false)))
+	waitFor(t, func() bool {
+		data, _ := ioutil.ReadFile(fp)
+		return string(data) == "one\n"
+	})
+
+	// flushed on close
+	wh.SetBuffer(4096, time.Hour)
+	require.NoError(t, wh.Event(event.New(0, event.Info, "two", nil, false)))
+	require.NoError(t, wh.Close())
+	data, err := ioutil.ReadFile(fp)
+	require.NoError(t, err)
+	assert.Equal(t, "one\ntwo\n", string(data))
+}
+
+func TestWriterHandler_SetBuffer_flushError(t *testing.T) {
+	writeErr := errors.New("disk full")
+	wh, err := New(failWriter{writeErr}, "")
+	require.NoError(t, err)
+	wh.SetBuffer(4096, time.Millisecond)
+	defer wh.Close()
+
+	require.NoError(t, wh.Event(event.New(0, event.Info, "msg", nil, false)))
+	// the periodic flush fails, and the error is reported by the next event
+	waitFor(t, func() bool {
+		wh.mutex.Lock()
+		defer wh.mutex.Unlock()
+		return wh.flushErr != nil
+	})
+	assert.Equal(t, writeErr, wh.Event(event.New(0, event.Info, "msg", nil, false)))
+}
@@ -17,12 +17,41 @@ var exit func(code int) = os.Exit // this is for testing so we can prevent an ac
 // Fields is a convenience type for passing ancillary data when generating events.
 type Fields map[string]interface{}
 
+// Lazy wraps a function which computes a field value, so that it is only called if the event is generated.
+// Events which no handler will accept (see LevelAccepter) are not generated, making this suitable for expensive values. For example:
+//  logger.Debug("cache state", sawmill.Fields{"cache": sawmill.Lazy(func() interface{} { return cache.Dump() })})
+//
+// The function is called on the goroutine generating the event. See event.Lazy.
+func Lazy(valueFunc func() interface{}) event.Lazy {
+	return event.Lazy(valueFunc)
+}
+
+// Deferred wraps a function which computes a field value, so that it is only called when a handler needs the value, such as when formatting it.
+// The function is called on a handler's goroutine, and thus must be safe for concurrent use. See event.Deferred.
+func Deferred(valueFunc func() interface{}) *event.Deferred {
+	return event.NewDeferred(valueFunc)
+}
+
 // Handler represents a destination for sawmill to send events to.
 // It responds to a single method, `Event`, which accepts the event to process. It must not return until the event has been fully processed.
 type Handler interface {
 	Event(event *event.Event) error
 }
 
+// LevelAccepter may be implemented by a Handler to indicate which event levels it will accept.
+// When no handler on a logger accepts an event's level, the logger does not generate the event at all. This means field values are not copied, and Lazy values are not evaluated.
+//
+// Handlers which do not implement this interface are assumed to accept all levels.
+type LevelAccepter interface {
+	AcceptsLevel(level event.Level) bool
+}
+
+// Flusher may be implemented by a Handler which buffers its output.
+// Flush() is called once the handler has processed all of its pending events after being removed from the logger, including by Stop(), or replaced by AddHandler().
+type Flusher interface {
+	Flush() error
+}
+
 type eventHandlerSpec struct {
 	name          string
 	handler       Handler
@@ -43,6 +72,8 @@ type Logger struct {
 	waitgroup       sync.WaitGroup
 	lastEventId     uint64
 	syncEnabled     uint32
+	poolingEnabled  uint32
+	callerEnabled   uint32
 }
 
 // NewLogger constructs a Logger.
@@ -115,14 +146,20 @@ func handlerDriver(spec *eventHandlerSpec, handler Handler, waitgroup *sync.Wait
 			break
 		}
 
+		eventId := logEvent.Id
 		handler.Event(logEvent) //TODO error handler
+		logEvent.Release()
 
 		spec.lastProcessedEventIdCond.L.Lock()
-		spec.lastProcessedEventId = logEvent.Id
+		spec.lastProcessedEventId = eventId
 		spec.lastProcessedEventIdCond.Broadcast()
 		spec.lastProcessedEventIdCond.L.Unlock()
 	}
 
+	if flusher, ok := handler.(Flusher); ok {
+		flusher.Flush() //TODO error handler
+	}
+
 	finishChannel <- true
 }
 
@@ -225,8 +262,31 @@ func (logger *Logger) InitStdSyslog() error {
 
 // Event queues a message at the given level.
 // Additional fields may be provided, which will be recursively copied at the time of the function call, and provided to the destination output handler.
+// If all the fields are typed fields (e.g. String(), Int()), the event is generated without reflection.
+// If no handler will accept the event (see LevelAccepter), the event is discarded without copying the fields.
 // It returns an event Id that can be used with Sync().
 func (logger *Logger) Event(level event.Level, message string, fields ...interface{}) uint64 {
+	if !logger.acceptsLevel(level) {
+		// Nobody wants it, so don't waste time generating it.
+		// The Id is still consumed so that the return value remains valid for Sync().
+		return atomic.AddUint64(&logger.lastEventId, 1)
+	}
+
+	getStack := int32(level) >= atomic.LoadInt32(&logger.stackMinLevel)
+
+	pooling := logger.GetEventPooling()
+
+	if typedFields, ok := typedFields(fields); ok {
+		var logEvent *event.Event
+		if pooling {
+			logEvent = event.AcquireWithFields(0, level, message, typedFields, getStack)
+		} else {
+			logEvent = event.NewWithFields(0, level, message, typedFields, getStack)
+		}
+		logger.setCaller(logEvent)
+		return logger.SendEvent(logEvent)
+	}
+
 	var eventFields interface{}
 	if len(fields) > 1 {
 		eventFields = fields
@@ -236,42 +296,74 @@ func (logger *Logger) Event(level event.Level, message string, fields ...interfa
 		eventFields = nil
 	}
 
-	getStack := int32(level) >= atomic.LoadInt32(&logger.stackMinLevel)
 	//TODO do we want to just remove the id param from event.New()?
-	logEvent := event.New(0, level, message, eventFields, getStack)
+	var logEvent *event.Event
+	if pooling {
+		logEvent = event.Acquire(0, level, message, eventFields, getStack)
+	} else {
+		logEvent = event.New(0, level, message, eventFields, getStack)
+	}
+	logger.setCaller(logEvent)
 
 	return logger.SendEvent(logEvent)
 }
 
+// setCaller populates the event's Caller if caller information is enabled, and the event doesn't already have it from a stack trace.
+func (logger *Logger) setCaller(logEvent *event.Event) {
+	if logEvent.Caller == nil && logger.GetCallerInfo() {
+		logEvent.Caller = event.CaptureCaller()
+	}
+}
+
+// acceptsLevel indicates whether any of the handlers will accept an event of the given level.
+func (logger *Logger) acceptsLevel(level event.Level) bool {
+	logger.mutex.RLock()
+	defer logger.mutex.RUnlock()
+	for _, eventHandlerSpec := range logger.eventHandlerMap {
+		levelAccepter, ok := eventHandlerSpec.handler.(LevelAccepter)
+		if !ok || levelAccepter.AcceptsLevel(level) {
+			return true
+		}
+	}
+	return false
+}
+
 // SendEvent queues the given event.
 // The event's `Id` field will be updated with a value that can be used by
 // Sync(). This value is also provided as the return value for convenience.
+//
+// If the event came from event.Acquire(), SendEvent takes over the caller's reference, and the event must not be used after SendEvent returns.
 func (logger *Logger) SendEvent(logEvent *event.Event) uint64 {
-	logEvent.Id = atomic.AddUint64(&logger.lastEventId, 1)
+	eventId := atomic.AddUint64(&logger.lastEventId, 1)
+	logEvent.Id = eventId
 
 	logger.mutex.RLock()
 	for _, eventHandlerSpec := range logger.eventHandlerMap {
+		// each handler driver releases its reference once the handler is done with the event
+		logEvent.Retain()
 		if true { //TODO make dropping configurable per-handler
 			select {
 			case eventHandlerSpec.eventChannel <- logEvent:
-				atomic.StoreUint64(&eventHandlerSpec.lastSentEventId, logEvent.Id)
+				atomic.StoreUint64(&eventHandlerSpec.lastSentEventId, eventId)
 			default:
+				logEvent.Release()
 				fmt.Fprintf(os.Stderr, "Unable to send event to handler. Buffer full. handler=%s\n", eventHandlerSpec.name)
 				//TODO generate an event for this, but put in a time-last-dropped so we don't send the message to the handler which is dropping
 				// basically if we are dropping, and we last dropped < X seconds ago, don't generate another "event dropped" message
 			}
 		} else {
 			eventHandlerSpec.eventChannel <- logEvent
-			atomic.StoreUint64(&eventHandlerSpec.lastSentEventId, logEvent.Id)
+			atomic.StoreUint64(&eventHandlerSpec.lastSentEventId, eventId)
 		}
 	}
 	logger.mutex.RUnlock()
+	logEvent.Release()
 
 	if logger.GetSync() {
-		logger.Sync(logEvent.Id)
+		logger.Sync(eventId)
 	}
 
-	return logEvent.Id
+	return eventId
 }
 
 // Emergency generates an event at the emergency level.
@@ -362,3 +454,35 @@ func (logger *Logger) SetSync(enabled bool) {
 func (logger *Logger) GetSync() bool {
 	return atomic.LoadUint32(&logger.syncEnabled) == 1
 }
+
+// SetEventPooling controls whether events are obtained from a pool (see event.Acquire()) instead of being allocated, reducing garbage collector pressure.
+// Pooled events are recycled once every handler has processed them.
+//
+// Only enable pooling when every handler either finishes with the event before its Event() method returns, or calls Retain() on the event. All the handlers provided by sawmill do one or the other.
+func (logger *Logger) SetEventPooling(enabled bool) {
+	if enabled {
+		atomic.StoreUint32(&logger.poolingEnabled, 1)
+	} else {
+		atomic.StoreUint32(&logger.poolingEnabled, 0)
+	}
+}
+
+// SetCallerInfo controls whether events include the source location which generated them (the event's Caller field).
+// This is much cheaper than a stack trace (see SetStackMinLevel), and is available to formatters as `{{.Caller}}` and `{{.ShortCaller}}`.
+func (logger *Logger) SetCallerInfo(enabled bool) {
+	if enabled {
+		atomic.StoreUint32(&logger.callerEnabled, 1)
+	} else {
+		atomic.StoreUint32(&logger.callerEnabled, 0)
+	}
+}
+
+// GetCallerInfo indicates whether events include caller information.
+func (logger *Logger) GetCallerInfo() bool {
+	return atomic.LoadUint32(&logger.callerEnabled) == 1
+}
+
+// GetEventPooling indicates whether event pooling is enabled.
+func (logger *Logger) GetEventPooling() bool {
+	return atomic.LoadUint32(&logger.poolingEnabled) == 1
+}
@@ -3,14 +3,17 @@ package sawmill
 import (
 	"fmt"
 	"runtime"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/phemmer/sawmill/event"
+	"github.com/phemmer/sawmill/handler/capture"
 	"github.com/phemmer/sawmill/handler/channel"
 	"github.com/phemmer/sawmill/handler/filter"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoggerEvent(t *testing.T) {
@@ -99,6 +102,28 @@ func TestLoggerAddDuplicateHandler(t *testing.T) {
 	assert.NotNil(t, handler2.Next(time.Millisecond))
 }
 
+type flushHandler struct {
+	capture.Handler
+	flushed bool
+}
+
+func (handler *flushHandler) Flush() error {
+	handler.flushed = true
+	return nil
+}
+
+func TestLoggerFlusher(t *testing.T) {
+	logger := NewLogger()
+	handler := &flushHandler{}
+	logger.AddHandler("TestFlush", handler)
+
+	logger.Sync(logger.Event(InfoLevel, "TestFlush"))
+	assert.False(t, handler.flushed)
+
+	logger.Stop()
+	assert.True(t, handler.flushed)
+}
+
 func TestLoggerFilterHandler(t *testing.T) {
 	logger := NewLogger()
 
@@ -344,5 +369,185 @@ func TestGetStackMinLevel(t *testing.T) {
 	assert.Equal(t, DebugLevel, logger.GetStackMinLevel())
 }
 
+func TestSetCallerInfo(t *testing.T) {
+	logger := NewLogger()
+	defer logger.Stop()
+
+	handler := channel.NewHandler()
+	logger.AddHandler("TestSetCallerInfo", handler)
+
+	logger.Info("foo")
+	logEvent := handler.Next(time.Second)
+	require.NotNil(t, logEvent)
+	assert.Nil(t, logEvent.Caller)
+
+	logger.SetCallerInfo(true)
+	assert.True(t, logger.GetCallerInfo())
+	logger.Info("bar")
+	logEvent = handler.Next(time.Second)
+	require.NotNil(t, logEvent)
+	require.NotNil(t, logEvent.Caller)
+	assert.Empty(t, logEvent.Stack)
+	// As with TestSetStackMinLevel, the first frame outside the sawmill repo is in the testing package.
+	assert.Equal(t, "testing", logEvent.Caller.Package)
+
+	logger.Info("baz", String("foo", "bar"))
+	logEvent = handler.Next(time.Second)
+	require.NotNil(t, logEvent)
+	assert.NotNil(t, logEvent.Caller)
+
+	// when a stack is captured, the caller is the top of the stack
+	logger.SetStackMinLevel(DebugLevel)
+	logger.Info("qux")
+	logEvent = handler.Next(time.Second)
+	require.NotNil(t, logEvent)
+	require.NotEmpty(t, logEvent.Stack)
+	assert.True(t, logEvent.Caller == logEvent.Stack[0])
+}
+
 // Test dropping
 // Test Stop()
+
+func TestLoggerLazy(t *testing.T) {
+	logger := NewLogger()
+	defer logger.Stop()
+
+	handler := channel.NewHandler()
+	logger.AddHandler("TestLazy", logger.FilterHandler(handler).LevelMin(InfoLevel))
+
+	calls := 0
+	lazy := Lazy(func() interface{} { calls++; return "expensive" })
+
+	logger.Debug("TestLazy", Fields{"lazy": lazy})
+	assert.Equal(t, 0, calls)
+	assert.Nil(t, handler.Next(time.Millisecond))
+
+	logger.Info("TestLazy", Fields{"lazy": lazy})
+	assert.Equal(t, 1, calls)
+	logEvent := handler.Next(time.Second)
+	if assert.NotNil(t, logEvent) {
+		assert.Equal(t, "expensive", logEvent.FlatFields["lazy"])
+	}
+}
+
+func TestLoggerLazy_unfilteredHandler(t *testing.T) {
+	logger := NewLogger()
+	defer logger.Stop()
+
+	logger.AddHandler("filtered", logger.FilterHandler(channel.NewHandler()).LevelMin(InfoLevel))
+	handler := channel.NewHandler()
+	logger.AddHandler("unfiltered", handler)
+
+	calls := 0
+	logger.Debug("TestLazy", Fields{"lazy": Lazy(func() interface{} { calls++; return "expensive" })})
+	assert.Equal(t, 1, calls)
+	assert.NotNil(t, handler.Next(time.Second))
+}
+
+func TestLoggerTypedFields(t *testing.T) {
+	logger := NewLogger()
+	defer logger.Stop()
+
+	handler := channel.NewHandler()
+	logger.AddHandler("TestTypedFields", handler)
+
+	logger.Info("TestTypedFields", String("string", "foo"), Int("int", 1), Dur("dur", time.Second), Err(fmt.Errorf("bar")))
+	logEvent := handler.Next(time.Second)
+	if assert.NotNil(t, logEvent) {
+		assert.Equal(t, "foo", logEvent.FlatFields["string"])
+		assert.Equal(t, 1, logEvent.FlatFields["int"])
+		assert.Equal(t, "1s", logEvent.FlatFields["dur"])
+		assert.Equal(t, "bar", logEvent.FlatFields["error"])
+	}
+
+	// typed fields mixed with other data
+	logger.Info("TestTypedFields", String("string", "foo"), Fields{"pop": "tart"})
+	logEvent = handler.Next(time.Second)
+	if assert.NotNil(t, logEvent) {
+		assert.Equal(t, "foo", logEvent.FlatFields["0.string"])
+		assert.Equal(t, "tart", logEvent.FlatFields["1.pop"])
+	}
+}
+
+type nopHandler struct{}
+
+func (nopHandler) Event(*event.Event) error { return nil }
+
+func BenchmarkLoggerEvent_fields(b *testing.B) {
+	logger := NewLogger()
+	defer logger.Stop()
+	logger.AddHandler("nop", nopHandler{})
+	logger.SetSync(true)
+	err := fmt.Errorf("foo")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Info("benchmark", Fields{"method": "GET", "path": "/foo", "status": 200, "duration": time.Millisecond, "error": err})
+	}
+}
+
+func BenchmarkLoggerEvent_fieldsPooled(b *testing.B) {
+	logger := NewLogger()
+	defer logger.Stop()
+	logger.AddHandler("nop", nopHandler{})
+	logger.SetSync(true)
+	logger.SetEventPooling(true)
+	err := fmt.Errorf("foo")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Info("benchmark", Fields{"method": "GET", "path": "/foo", "status": 200, "duration": time.Millisecond, "error": err})
+	}
+}
+
+func BenchmarkLoggerEvent_typedFieldsPooled(b *testing.B) {
+	logger := NewLogger()
+	defer logger.Stop()
+	logger.AddHandler("nop", nopHandler{})
+	logger.SetSync(true)
+	logger.SetEventPooling(true)
+	err := fmt.Errorf("foo")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Info("benchmark", String("method", "GET"), String("path", "/foo"), Int("status", 200), Dur("duration", time.Millisecond), Err(err))
+	}
+}
+
+func BenchmarkLoggerEvent_typedFields(b *testing.B) {
+	logger := NewLogger()
+	defer logger.Stop()
+	logger.AddHandler("nop", nopHandler{})
+	logger.SetSync(true)
+	err := fmt.Errorf("foo")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Info("benchmark", String("method", "GET"), String("path", "/foo"), Int("status", 200), Dur("duration", time.Millisecond), Err(err))
+	}
+}
+
+func TestLoggerEventPooling(t *testing.T) {
+	logger := NewLogger()
+	defer logger.Stop()
+	logger.SetEventPooling(true)
+	assert.True(t, logger.GetEventPooling())
+
+	handler := capture.NewHandler()
+	logger.AddHandler("capture", handler)
+	logger.AddHandler("nop", nopHandler{})
+	logger.SetSync(true)
+
+	for i := 0; i < 100; i++ {
+		logger.Info("pooled", String("i", strconv.Itoa(i)))
+		logger.Info("pooled", Fields{"i": strconv.Itoa(i)})
+	}
+
+	// the capture handler retains its events, so none of them may have been recycled
+	logEvents := handler.Events()
+	require.Len(t, logEvents, 200)
+	for i, logEvent := range logEvents {
+		assert.Equal(t, "pooled", logEvent.Message)
+		assert.Equal(t, strconv.Itoa(i/2), logEvent.FlatFields["i"])
+	}
+}
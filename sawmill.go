@@ -7,6 +7,18 @@ Because of this asynchronous processing, it is critical that you add a `defer sa
 Structured: Sawmill places a heavy emphasis on events with ancillary data.
 A log event (e.g. `sawmill.Error()`) should have a simple string that is an event description, such as "Image processing failed", and then a map or struct included with details on the event.
 
+Structs included with an event may control how their fields are logged with a `sawmill` struct tag, similar to encoding/json:
+ type Config struct {
+ 	Host     string `sawmill:"host"`              // logged under the key "host"
+ 	Port     int    `sawmill:"port,omitempty"`    // omitted if zero
+ 	Password string `sawmill:"password,redact"`   // value replaced with "[REDACTED]"
+ 	Timeouts        `sawmill:",flatten"`          // nested fields merged into the parent
+ 	Internal string `sawmill:"-"`                 // never logged
+ }
+To use `json` tags on fields which lack a `sawmill` tag, set event.StructTagJSONFallback.
+
+Types may also fully control how they are logged by implementing event.Valuer or event.Fielder. Types from other packages can be handled with event.RegisterValueFunc.
+
 ----
 
 The base package provides a default logger that will send events to STDOUT or STDERR as appropriate. This default logger is shared by all consumers of the package.
@@ -205,6 +217,28 @@ func GetSync() bool {
 	return DefaultLogger().GetSync()
 }
 
+// SetCallerInfo controls whether events include the source location which
+// generated them. See Logger.SetCallerInfo().
+func SetCallerInfo(enabled bool) {
+	DefaultLogger().SetCallerInfo(enabled)
+}
+
+// GetCallerInfo indicates whether events include caller information.
+func GetCallerInfo() bool {
+	return DefaultLogger().GetCallerInfo()
+}
+
+// SetEventPooling controls whether events are obtained from a pool instead of
+// being allocated. See Logger.SetEventPooling().
+func SetEventPooling(enabled bool) {
+	DefaultLogger().SetEventPooling(enabled)
+}
+
+// GetEventPooling indicates whether event pooling is enabled.
+func GetEventPooling() bool {
+	return DefaultLogger().GetEventPooling()
+}
+
 // Stop removes all destinations on the logger, and waits for any pending events to flush to their destinations.
 func Stop() {
 	DefaultLogger().checkPanic(recover())